@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"mua/token"
 	"strings"
 )
@@ -9,6 +10,7 @@ import (
 type Node interface {
 	TokenLiteral() string	// for debugging
 	String()	   string	// debug and compare with other AST nodes
+	Pos()		   token.Position	// position of the token of the node
 }
 
 type Statement interface {
@@ -34,6 +36,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -51,6 +60,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()	   {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position { return i.Token.Position }
 func (i *Identifier) String() string       { return i.Value }
 
 type IntegerLiteral struct {
@@ -60,8 +70,38 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()		{}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position { return il.Token.Position }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type BigIntegerLiteral struct {
+	Token token.Token		// token.BIGINT
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode()      {}
+func (bl *BigIntegerLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BigIntegerLiteral) Pos() token.Position { return bl.Token.Position }
+func (bl *BigIntegerLiteral) String() string       { return bl.Token.Literal }
+
+type FloatLiteral struct {
+	Token token.Token		// token.FLOAT
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position { return fl.Token.Position }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+type NullLiteral struct {
+	Token token.Token		// token.NULL
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) Pos() token.Position { return nl.Token.Position }
+func (nl *NullLiteral) String() string       { return nl.Token.Literal }
+
 type Boolean struct {
 	Token token.Token		// token.TRUE, token.FALSE
 	Value bool
@@ -69,6 +109,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position { return b.Token.Position }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type StringLiteral struct {
@@ -78,6 +119,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position { return sl.Token.Position }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type ArrayLiteral struct {
@@ -87,6 +129,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position { return al.Token.Position }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -102,16 +145,18 @@ func (al *ArrayLiteral) String() string {
 type HashLiteral struct {
 	Token token.Token		// token.L_BRACE
 	Pairs map[Expression]Expression
+	Keys  []Expression			// the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position { return hl.Token.Position }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String() + ":" + value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String() + ":" + hl.Pairs[key].String())
 	}
 
 	out.WriteString("{" + strings.Join(pairs, ", ") + "}")
@@ -126,6 +171,7 @@ type MacroLiteral struct {
 
 func (ml *MacroLiteral) expressionNode()      {}
 func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position { return ml.Token.Position }
 func (ml *MacroLiteral) String() string {
 	var out bytes.Buffer
 
@@ -140,16 +186,22 @@ func (ml *MacroLiteral) String() string {
 
 // array[0]
 type IndexExpression struct {
-	Token token.Token		// token.L_BRACKET
+	Token token.Token		// token.L_BRACKET, token.SAFE_INDEX
 	Left  Expression
 	Index Expression
+	Safe  bool				// a?[k] is null instead of indexing a null
 }
 
 func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position { return ie.Token.Position }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString("(" + ie.Left.String() + "[" + ie.Index.String() + "])")
+	open := "["
+	if ie.Safe {
+		open = "?["
+	}
+	out.WriteString("(" + ie.Left.String() + open + ie.Index.String() + "])")
 	return out.String()
 }
 
@@ -161,6 +213,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()       {}
 func (pe *PrefixExpression) TokenLiteral() string  { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position { return pe.Token.Position }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(" + pe.Operator + pe.Right.String() + ")")
@@ -176,12 +229,29 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()		 {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position { return ie.Token.Position }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(" + ie.Left.String() + " " + ie.Operator + " " + ie.Right.String() + ")")
 	return out.String()
 }
 
+// x = 5; array[0] = 5
+type AssignExpression struct {
+	Token  token.Token		// token.ASSIGN
+	Target Expression		// Identifier or IndexExpression
+	Value  Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position { return ae.Token.Position }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(" + ae.Target.String() + " = " + ae.Value.String() + ")")
+	return out.String()
+}
+
 type ExpressionStatement struct {
 	Token	   token.Token		// the first token of the expression
 	Expression Expression
@@ -189,6 +259,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()		 {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Position }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -202,6 +273,7 @@ type BlockStatement struct {
 }
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position { return bs.Token.Position }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -218,6 +290,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()		  {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Position }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -238,6 +311,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Position }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -261,6 +335,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position { return ie.Token.Position }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if" + ie.Condition.String() + " " + ie.Consequence.String())
@@ -275,10 +350,12 @@ type FunctionLiteral struct {
 	Token      token.Token		// token.FUNCTIOn
 	Parameters []*Identifier
 	Body	   *BlockStatement
+	Name	   string			// the binding of `let name = fn...`, empty if anonymous
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position { return fl.Token.Position }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	
@@ -303,6 +380,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position { return ce.Token.Position }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -313,4 +391,55 @@ func (ce *CallExpression) String() string {
 	out.WriteString(ce.Function.String() + "(" + strings.Join(args, ", ") + ")")
 	
 	return out.String()
-}
\ No newline at end of file
+}
+
+// while (<cond>) <body>
+type WhileStatement struct {
+	Token     token.Token		// token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position { return ws.Token.Position }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while" + ws.Condition.String() + " " + ws.Body.String())
+	return out.String()
+}
+
+// for (<variable> in <iterable>) <body>
+type ForStatement struct {
+	Token    token.Token		// token.FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Position }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for(" + fs.Variable.String() + " in " + fs.Iterable.String() + ") " + fs.Body.String())
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token		// token.BREAK
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position { return bs.Token.Position }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+type ContinueStatement struct {
+	Token token.Token		// token.CONTINUE
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position { return cs.Token.Position }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
\ No newline at end of file
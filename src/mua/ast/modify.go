@@ -26,9 +26,18 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		if node.Alternative != nil {
 			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
 		}
+	case *WhileStatement:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ForStatement:
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 	case *InfixExpression:
 		node.Left, _ = Modify(node.Left, modifier).(Expression)
 		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *AssignExpression:
+		node.Target, _ = Modify(node.Target, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *PrefixExpression:
 		node.Right, _ = Modify(node.Right, modifier).(Expression)
 	case *IndexExpression:
@@ -46,12 +55,17 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		}
 	case *HashLiteral:
 		newPairs := make(map[Expression]Expression)
+		newKeys := make(map[Expression]Expression)
 		for key, val := range node.Pairs {
 			newKey, _ := Modify(key, modifier).(Expression)
 			newVal, _ := Modify(val, modifier).(Expression)
 			newPairs[newKey] = newVal
+			newKeys[key] = newKey
 		}
 		node.Pairs = newPairs
+		for i, key := range node.Keys {
+			node.Keys[i] = newKeys[key]
+		}
 	}
 
 	return modifier(node)
@@ -7,46 +7,17 @@ import (
 
 /**
 * Registe BUILT-IN FUNCTIONs
-* 	- len
-* 	- first
-* 	- last
-*	- rest
-*	- push
-*	- pop
-*	- map
-*	- reduce
+*	- the library of object.Builtins, shared with the VM
 *
-*   - puts
+*   - print
 */
 var builtins = map[string]*object.Builtin {
-	"len": &object.Builtin{Fn: _len},
-	"first": &object.Builtin{Fn: _first},
 	"print": &object.Builtin{Fn: _print},
 }
 
-func _len(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1", len(args))
-	}
-
-	switch arg := args[0].(type) {
-	case *object.String:
-		return &object.Integer{Value: int64(len(arg.Value))}
-	case *object.Array:
-		return &object.Integer{Value: int64(len(arg.Elements))}
-	}
-	return newError("argument to `len` not supported, got %s", args[0].Type())
-}
-
-func _first(args ...object.Object) object.Object {
-	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1", len(args))
-	}
-	switch arg := args[0].(type) {
-	case *object.Array:
-		return arg.Elements[0]
-	default:
-		return newError("unsupported type: %T", args[0].Type())
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
 	}
 }
 
@@ -56,4 +27,4 @@ func _print(args ...object.Object) object.Object {
 	}
 
 	return NULL
-}
\ No newline at end of file
+}
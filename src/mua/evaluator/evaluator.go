@@ -1,7 +1,10 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"mua/ast"
 	"mua/object"
 	"mua/token"
@@ -9,9 +12,12 @@ import (
 
 // Singleton variable in the interpreter
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func newError(format string, a ...interface{}) *object.Error {
@@ -25,7 +31,62 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// Count a new object against the budget of the evaluation
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if budget := env.Budget(); budget != nil && !isError(obj) {
+		if err := budget.Allocate(obj); err != nil {
+			return newError("%s", err)
+		}
+	}
+	return obj
+}
+
+// Check the estimated result of a builtin against the budget before the
+// call, and count the result it built
+func callBuiltin(builtin *object.Builtin, args []object.Object, env *object.Environment) object.Object {
+	if budget := env.Budget(); budget != nil && builtin.Cost != nil {
+		if err := budget.Check(builtin.Cost(args...)); err != nil {
+			return newError("%s", err)
+		}
+	}
+	return allocate(env, applyFunction(builtin, args))
+}
+
+/**
+Evaluate with a budget like Eval. When the context is done or a limit is
+exceeded, the error is one of *object.CancelledError, *object.InstructionLimitError
+(counting evaluated nodes), *object.CallDepthError or *object.ObjectLimitError.
+Errors of the script itself are returned as *object.Error values, like Eval
+*/
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) (object.Object, error) {
+	budget := object.NewBudget(ctx, limits)
+	outer := env.Budget()
+	env.SetBudget(budget)
+	defer env.SetBudget(outer)
+
+	result := Eval(node, env)
+	if err := budget.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	// the innermost node an error escapes from is where it happened
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	if budget := env.Budget(); budget != nil {
+		if err := budget.Step(); err != nil {
+			return newError("%s", err)
+		}
+	}
+
 	switch node := node.(type) {
 	
 	// Statements
@@ -36,43 +97,57 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return allocate(env, &object.Integer{Value: node.Value})
+	case *ast.BigIntegerLiteral:
+		return allocate(env, &object.BigInt{Value: node.Value})
+	case *ast.FloatLiteral:
+		return allocate(env, &object.Float{Value: node.Value})
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return allocate(env, &object.String{Value: node.Value})
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(env, &object.Array{Elements: elements})
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return allocate(env, evalHashLiteral(node, env))
 
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) { return left }
-		index := Eval(node.Index, env)
-		if isError(index) { return index }
-		return evalIndexExpression(left, index)
+		result, _ := evalIndexChain(node, env)
+		return result
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return allocate(env, &object.Function{Parameters: params, Env: env, Body: body})
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) { return right }
-		return evalPrefixExpression(node.Operator, right)
+		return allocate(env, evalPrefixExpression(node.Operator, right))
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) { return left }
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node.Operator, left, node.Right, env)
+		}
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
 		if isError(right) { return right }
-		return evalInfixExpression(node.Operator, left, right)
+		return allocate(env, evalInfixExpression(node.Operator, left, right))
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
 			return quote(node.Arguments[0], env)
@@ -84,6 +159,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
+		if builtin, ok := function.(*object.Builtin); ok {
+			return callBuiltin(builtin, args, env)
+		}
 		return applyFunction(function, args)
 
 	case *ast.LetStatement:
@@ -95,9 +173,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := evalTailExpression(node.ReturnValue, env)
 		if isError(val) { return val }
 		return &object.ReturnValue{Value: val}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	}
 
 	return nil
@@ -111,6 +197,9 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
+			if call, ok := result.Value.(*tailCall); ok {
+				return applyFunction(call.function, call.args)
+			}
 			return result.Value
 		case *object.Error:
 			return result
@@ -126,7 +215,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 		result = Eval(stmt, env)
 		if result != nil && (
 			result.Type() == object.RETURN_VALUE_OBJ ||
-			result.Type() == object.ERROR_OBJ ) {
+			result.Type() == object.ERROR_OBJ ||
+			result == BREAK || result == CONTINUE ) {
 			return result
 		}
 	}
@@ -141,24 +231,43 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) { return key }
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
-			return newError("Unhashable type: %s", key.Type())
+			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) { return value }
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
+	}
+	return hash
+}
+
+// A null before `?[` skips the rest of the chain, so a?[0][1] is null too.
+// skipped reports that to the enclosing index expressions
+func evalIndexChain(node *ast.IndexExpression, env *object.Environment) (result object.Object, skipped bool) {
+	var left object.Object
+	if inner, ok := node.Left.(*ast.IndexExpression); ok {
+		left, skipped = evalIndexChain(inner, env)
+		if skipped { return NULL, true }
+	} else {
+		left = Eval(node.Left, env)
 	}
-	return &object.Hash{Pairs: pairs}
+	if isError(left) { return left, false }
+	if node.Safe && left == NULL {
+		return NULL, true
+	}
+
+	index := Eval(node.Index, env)
+	if isError(index) { return index, false }
+	return evalIndexExpression(left, index), false
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -183,16 +292,62 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
-		return newError("Unhashable type: %s", index.Type())
+		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return NULL
 	}
-	return pair.Value
+	return value
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		val := Eval(node.Value, env)
+		if isError(val) { return val }
+
+		if _, ok := env.Assign(target.Value, val); !ok {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return val
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) { return left }
+		index := Eval(target.Index, env)
+		if isError(index) { return index }
+		val := Eval(node.Value, env)
+		if isError(val) { return val }
+
+		return evalIndexAssignment(left, index, val)
+	}
+	return newError("cannot assign to %s", node.Target.String())
+}
+
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = val
+	case *object.Hash:
+		key, ok := object.AsHashable(index)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, val)
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+	return val
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
@@ -212,32 +367,36 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 	case FALSE:
 		return TRUE
 	case NULL:
-		return FALSE
+		return TRUE
 	}
 	return FALSE
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return newError("unknown operator: -%s", right.Type())
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return evalIntegerInfixExpression(operator, left, right)
 	}
+	if isNumber(left) && isNumber(right) {
+		return evalFloatInfixExpression(operator, left, right)
+	}
 	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
 		return evalStringInfixExpression(operator, left, right)
 	}
 
 	if operator == "==" {
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	} else if operator == "!=" {
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	}
 
 	if left.Type() != right.Type() {
@@ -246,25 +405,70 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
+// Integer and BigInt operands, results overflowing int64 become BigInt
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+	switch operator {
+	case "+", "-", "*", "/", "%", "**":
+		result, err := object.IntegerArithmetic(operator, left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
+	}
+
+	result := object.CompareIntegers(left, right)
+	switch operator {
+	// Logical Expression
+	case "<":
+		return nativeBoolToBooleanObject(result < 0)
+	case ">":
+		return nativeBoolToBooleanObject(result > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(result <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(result >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(result == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(result != 0)
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// Integer operands are promoted to float
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	
-	// Logical Expression
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	}
+
+	// Logical Expression, an integer and a float are compared without rounding
+	if left.Type() != right.Type() && !math.IsNaN(leftVal) && !math.IsNaN(rightVal) {
+		result, _ := object.Compare(left, right)
+		leftVal, rightVal = float64(result), 0
+	}
+	switch operator {
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -273,14 +477,58 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
 
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.IntegerToFloat(obj)
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != token.PLUS {
-		return newError("unknown operator: %s %s % s", left.Type(), operator, right.Type())
+	if operator == token.PLUS {
+		leftVal := left.(*object.String).Value
+		rightVal := right.(*object.String).Value
+		return &object.String{Value: leftVal + rightVal}
+	}
+
+	// strings are ordered lexicographically
+	result, _ := object.Compare(left, right)
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(result < 0)
+	case ">":
+		return nativeBoolToBooleanObject(result > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(result <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(result >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(result == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(result != 0)
+	}
+	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+}
+
+// the right operand is only evaluated if the left one doesn't decide the result
+func evalLogicalExpression(operator string, left object.Object, rightNode ast.Expression, env *object.Environment) object.Object {
+	if operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if operator == "||" && isTruthy(left) {
+		return TRUE
 	}
 
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	right := Eval(rightNode, env)
+	if isError(right) { return right }
+	return nativeBoolToBooleanObject(isTruthy(right))
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
@@ -295,6 +543,47 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	return NULL
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) { return condition }
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(ws.Body, env)
+		if result == BREAK {
+			return NULL
+		}
+		if isError(result) || result != nil && result.Type() == object.RETURN_VALUE_OBJ {
+			return result
+		}
+	}
+}
+
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) { return iterable }
+
+	iterator, ok := object.NewIterator(iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	for elem, ok := iterator.Next(); ok; elem, ok = iterator.Next() {
+		env.Set(fs.Variable.Value, elem)
+
+		result := Eval(fs.Body, env)
+		if result == BREAK {
+			break
+		}
+		if isError(result) || result != nil && result.Type() == object.RETURN_VALUE_OBJ {
+			return result
+		}
+	}
+	return NULL
+}
+
 func isTruthy(obj object.Object) bool {
 	// obj CAN BE object.Integer
 	// TODO: Check object.Integer{Value: 0}
@@ -326,21 +615,117 @@ func evalExpressions(exprs []ast.Expression, env *object.Environment) []object.O
 	return result
 }
 
+// Calls in tail position come back as *tailCall and run in this loop,
+// so tail recursion does not grow the Go stack
 func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		if len(args) != len(fn.Parameters) {
-			return newError("function parameter count not match: expected=%d, got=%d", 
-				len(fn.Parameters), len(args))
+	for {
+		switch function := fn.(type) {
+		case *object.Function:
+			if len(args) != len(function.Parameters) {
+				return newError("function parameter count not match: expected=%d, got=%d", 
+					len(function.Parameters), len(args))
+			}
+			budget := function.Env.Budget()
+			if budget != nil {
+				if err := budget.Enter(); err != nil {
+					return newError("%s", err)
+				}
+			}
+			extendedEnv := extendFunctionEnv(function, args)
+			evaluated := unwrapReturnValue(evalTailBlock(function.Body, extendedEnv))
+			if budget != nil {
+				budget.Leave()
+			}
+			if call, ok := evaluated.(*tailCall); ok {
+				fn, args = call.function, call.args
+				continue
+			}
+			return evaluated
+		case *object.Builtin:
+			if result := function.Call(caller{}, args...); result != nil {
+				return result
+			}
+			return NULL
 		}
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
-	case *object.Builtin:
-		return fn.Fn(args...)
+
+		return newError("not a function % s", fn.Type())
 	}
+}
 
-	return newError("not a function % s", fn.Type())
+// Runs the functions passed to builtins
+type caller struct{}
+
+func (caller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args)
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	if result == nil {
+		return NULL, nil
+	}
+	return result, nil
+}
+
+// A call whose result is returned by the enclosing function
+type tailCall struct {
+	function object.Object
+	args     []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string { return "tail call" }
+
+// Like evalBlockStatement, the last expression is in tail position
+func evalTailBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for i, stmt := range block.Statements {
+		if es, ok := stmt.(*ast.ExpressionStatement); ok && i == len(block.Statements) - 1 {
+			return evalTailExpression(es.Expression, env)
+		}
+
+		result = Eval(stmt, env)
+		if result != nil && (
+			result.Type() == object.RETURN_VALUE_OBJ ||
+			result.Type() == object.ERROR_OBJ ||
+			result == BREAK || result == CONTINUE ) {
+			return result
+		}
+	}
+	return result
+}
+
+// Delay a call in tail position, the branches of an if-expression are also in tail position
+func evalTailExpression(node ast.Expression, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return Eval(node, env)
+		}
+
+		function := Eval(node.Function, env)
+		if isError(function) { return function }
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if builtin, ok := function.(*object.Builtin); ok {
+			return callBuiltin(builtin, args, env)
+		}
+		return &tailCall{function: function, args: args}
+
+	case *ast.IfExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) { return condition }
+
+		if isTruthy(condition) {
+			return evalTailBlock(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return evalTailBlock(node.Alternative, env)
+		}
+		return NULL
+	}
+	return Eval(node, env)
 }
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
@@ -1,10 +1,15 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"mua/lexer"
 	"mua/object"
 	"mua/parser"
+	"mua/token"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -27,6 +32,15 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"max(1, 3) * min([4, 2]) + gcd(4, 6)", 8},
+		{"floor(2.7) + ceil(2.1) + abs(-1)", 6},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"-9223372036854775808", -9223372036854775808},
+		{"let h = {18446744073709551616: 1}; h[2 ** 64]", 1},
 	}
 
 	for _, tt := range tests {
@@ -35,6 +49,84 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 4", "18446744073709551616"},
+		{"2 ** 64", "18446744073709551616"},
+		{"-9223372036854775808 / -1", "9223372036854775808"},
+		{"-99999999999999999999", "-99999999999999999999"},
+		{"abs(-99999999999999999999)", "99999999999999999999"},
+		{`parse_int("99999999999999999999")`, "99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("%q is not BigInt. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q has wrong value. want=%s, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	testBooleanObject(t, testEval("99999999999999999999 > 9223372036854775807"), true)
+	testBooleanObject(t, testEval("10 ** 20 == 100000000000000000000"), true)
+	testBooleanObject(t, testEval("9007199254740993 == 9007199254740992.0"), false)
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5 * 2", 4.5},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"2 * (0.25 + 0.25)", 1.0},
+		{"7.5 % 2", 1.5},
+		{"2 ** -1", 0.5},
+		{"sqrt(16) + pow(4, 0.5)", 6.0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		result, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Fatalf("object is not Float. got=%T (%+v)", evaluated, evaluated)
+		}
+		if result.Value != tt.expected {
+			t.Errorf("object wrong value. expected=%g. got=%g.", tt.expected, result.Value)
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2.5", "2.5"},
+		{"1.0 * 2", "2.0"},
+		{"1e21 * 10", "1e+22"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect. expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -94,6 +186,20 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"false", false},
 		{"1 < 2", true},
 		{"1 > 2", false},
+		{"1.5 > 1", true},
+		{"2.0 == 2", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"let n = 0; let f = fn() { n = n + 1; true }; false && f(); true || f(); n == 0", true},
+		{"let n = 0; let f = fn() { n = n + 1; true }; true && f(); false || f(); n == 2", true},
 		{"1 < 1", false},
 		{"1 > 1", false},
 		{"1 == 1", true},
@@ -118,6 +224,78 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"apple" < "banana"`, true},
+		{`"b" >= "abc"`, true},
+		{`"Z" > "a"`, false},
+		{`"" <= ""`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2.0] == [1.0, 2]", true},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`[{"a": [1]}] == [{"a": [1]}]`, true},
+		{`[1, "a", true] == [1, "a", true]`, true},
+		{"[1] == 1", false},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b", true},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{`contains([[1, 2]], [1, 2])`, true},
+		{`sort(["pear", "apple", "fig"]) == ["apple", "fig", "pear"]`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestNullOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"null == null", true},
+		{"[1, 2][5] == null", true},
+		{"null ?? 1", 1},
+		{"2 ?? 1", 2},
+		{"false ?? 1", false},
+		{"null ?? null ?? 3", 3},
+		{"let n = 0; let f = fn() { n = n + 1 }; 1 ?? f(); n", 0},
+		{`let h = null; h?["a"]`, nil},
+		{`let h = {"a": {"b": 1}}; h?["a"]?["b"]`, 1},
+		{`let h = {"a": null}; h?["a"]?["b"] ?? 7`, 7},
+		{"let a = null; a?[0][1]", nil},
+		{"let a = null; a?[0][1][2] ?? 3", 3},
+		{"let a = [[1, [2]]]; a?[0][1][0]", 2},
+		{"let n = 0; let f = fn() { n = n + 1 }; null?[f()]; n", 0},
+		{"let get = fn(a) { a?[0] ?? -1 }; get([]) + get(null)", -2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -228,14 +406,24 @@ let two = "two"
 		TRUE.HashKey(): 							5,
 		FALSE.HashKey(): 							6,
 	}
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash pairs number wrong. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash pairs number wrong. got=%d", result.Len())
+	}
+
+	pairs := map[object.HashKey]object.HashPair{}
+	keys := []string{}
+	for _, pair := range result.Pairs() {
+		pairs[pair.Key.(object.Hashable).HashKey()] = pair
+		keys = append(keys, pair.Key.Inspect())
+	}
+	if strings.Join(keys, " ") != "one two three 4 true false" {
+		t.Errorf("Hash pairs in wrong order. got=%v", keys)
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := pairs[expectedKey]
 		if !ok {
-			t.Errorf("Can't find the pair for key: %q.", expectedKey)
+			t.Errorf("Can't find the pair for key: %v.", expectedKey)
 		}
 		testIntegerObject(t, pair.Value, expectedValue)
 	}
@@ -274,6 +462,30 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[1, "a"]: 1, [1, "b"]: 2}[[1, "b"]]`,
+			2,
+		},
+		{
+			`{[1, 2]: 1}[[2, 1]]`,
+			nil,
+		},
+		{
+			`let k = [1]; let h = {}; h[k] = 1; k[0] = 2; h[[1]]`,
+			1,
+		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{0.0: 5}[-0.0]`,
+			5,
+		},
+		{
+			`{9007199254740993: 5}[9007199254740992.0]`,
+			nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -299,6 +511,8 @@ func TestBangObject(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!null", true},
+		{"!!null", false},
 		//{"!0", true},
 	}
 
@@ -368,6 +582,27 @@ if (10 > 1) {
 	}
 }
 
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected token.Position
+	}{
+		{"let x = 1;\nlet f = fn() { x + true };\nf()", token.Position{Line: 2, Column: 18}},
+		{"let a = [1];\nlen(a, a)", token.Position{Line: 2, Column: 4}},
+		{"if (true) {\n  foo\n}", token.Position{Line: 2, Column: 3}},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("no error for %q", tt.input)
+		}
+		if errObj.Pos != tt.expected {
+			t.Errorf("wrong position for %q. want=%s, got=%s", tt.input, tt.expected, errObj.Pos)
+		}
+	}
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input 	 string
@@ -377,6 +612,22 @@ func TestErrorHandling(t *testing.T) {
 			"5 + true",
 			"type mismatch: INTEGER + BOOLEAN",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(a, b) { a % b }; f(1, 0); 5",
+			"division by zero",
+		},
+		{
+			"18446744073709551616 / 0",
+			"division by zero",
+		},
+		{
+			"2 ** 100000000",
+			"integer too large",
+		},
 		{
 			"5 + true; 5;",
 			"type mismatch: INTEGER + BOOLEAN",
@@ -418,7 +669,11 @@ if (10 > 1) {
 		},
 		{
 			`{"name": "Mua-lang"}[fn(x) { x }];`,
-			"Unhashable type: FUNCTION",
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`{[1, fn(x) { x }]: 1}`,
+			"unusable as hash key: ARRAY",
 		},
 	}
 
@@ -452,6 +707,80 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestLoopStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let i = 0; let s = 0; while (i < 5) { let s = s + i; let i = i + 1; }; s`, 10},
+		{`let i = 0; while (true) { let i = i + 1; if (i > 3) { break; } }; i`, 4},
+		{`let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 2) { continue; } let s = s + i; }; s`, 13},
+		{`let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 7) { return i; } } }; f()`, 7},
+		{`let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s`, 6},
+		{`let s = 0; for (k in {1: "a", 2: "b"}) { let s = s + k; }; s`, 3},
+		{`let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } let s = s + x; }; s`, 4},
+		{`let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } }; f([1, 5, 9])`, 5},
+		{`let n = 0; for (c in "héllo") { let n = n + 1; }; n`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	evaluated := testEval(`for (x in 5) { x }`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "cannot iterate over INTEGER" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let x = 1; x = x + 1; x`, 2},
+		{`let x = 1; x = 5`, 5},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let i = 0; let s = 0; while (i < 5) { s = s + i; i = i + 1; }; s`, 10},
+		{`let x = 1; let f = fn() { x = 10; }; f(); x`, 10},
+		{`let x = 1; let f = fn(x) { x = 10; }; f(2); x`, 1},
+		{`let newCounter = fn() { let c = 0; fn() { c = c + 1; c } }; let c = newCounter(); c(); c(); c()`, 3},
+		{`let arr = [1, 2, 3]; arr[1] = 5; arr[0] + arr[1]`, 6},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`x = 1`, "identifier not found: x"},
+		{`let a = [1]; a[1] = 2`, "index out of range: 1"},
+		{`let s = "a"; s[0] = "b"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range errorTests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q no error object found. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("error message not match. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; }"
 
@@ -489,6 +818,36 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0);", 5000050000},
+		{"let count = fn(n) { if (n == 0) { return 0; } return count(n - 1); }; count(100000);", 0},
+		{"let f = fn(x) { len(x) }; return f(\"abc\");", 3},
+		{"let f = fn(x) { x(1) }; f(2);", "not a function INTEGER"},
+		{"let f = fn(x) { x(1) }; f(fn(a, b) { a });", "function parameter count not match: expected=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -519,6 +878,181 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestArrayBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`first([1, 2])`, 1},
+		{`first([])`, nil},
+		{`last([1, 2])`, 2},
+		{`rest([1, 2, 3])`, []int64{2, 3}},
+		{`let a = [1]; let b = push(a, 2); len(a) + len(b)`, 3},
+		{`slice([1, 2, 3, 4], -3, -1)`, []int64{2, 3}},
+		{`concat([1], [2, 3])`, []int64{1, 2, 3}},
+		{`reverse([1, 2, 3])`, []int64{3, 2, 1}},
+		{`if (contains([1, "a"], "a")) { 1 } else { 0 }`, 1},
+		{`contains([1, 2], 2) == true`, true},
+		{`index_of([1, 2, 3], 4)`, -1},
+		{`join(["a", 1], "-")`, "a-1"},
+		{`range(5, 0, -2)`, []int64{5, 3, 1}},
+		{`zip([1, 2], [3, 4])[1]`, []int64{2, 4}},
+		{`flatten([1, [2, 3], []])`, []int64{1, 2, 3}},
+		{`unique([1, 2, 1, 3, 2])`, []int64{1, 2, 3}},
+		{`first(1)`, &object.Error{Message: "argument 1 to `first` must be ARRAY, got INTEGER"}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case nil:
+			testNullObject(t, evaluated)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(arr.Elements))
+				continue
+			}
+			for i, value := range expected {
+				testIntegerObject(t, arr.Elements[i], value)
+			}
+		case *object.Error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not error. got=%T", evaluated)
+				continue
+			}
+			if errObj.Message != expected.Message {
+				t.Errorf("message wrong. expected=%q, got=%q", expected.Message, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`join(keys({"b": 1, "a": 2, 3: 3}), ",")`, "b,a,3"},
+		{`join(values({"b": 1, "a": 2}), ",")`, "1,2"},
+		{`let h = {}; h["z"] = 1; h["y"] = 2; h["z"] = 3; join(keys(h), ",")`, "z,y"},
+		{`join(items({"a": 1}), ",")`, "[a, 1]"},
+		{`join([has_key({"a": 1}, "a"), has_key({"a": 1}, "b")], ",")`, "true,false"},
+		{`let h = {1: 1, 2: 2}; join(keys(delete(h, 1)), ",") + join(keys(h), ",")`, "21,2"},
+		{`join(keys(merge({"a": 1, "b": 2}, {"c": 4, "a": 3})), ",")`, "a,b,c"},
+		{`let s = ""; for (k in {"x": 1, "y": 2, "w": 3}) { s = s + k }; s`, "xyw"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`join(split("a,b,,c", ","), "|")`, "a|b||c"},
+		{`upper(trim("  mua "))`, "MUA"},
+		{`replace("a.b", ".", "::")`, "a::b"},
+		{`to_string(contains("mua", "u")) + to_string(starts_with("mua", "x"))`, "truefalse"},
+		{`to_string(find("héllo", "llo"))`, "2"},
+		{`substr("héllo", 1, 3) + repeat("!", 2)`, "él!!"},
+		{`let s = "héllo"; substr(s, 0, len(s) - 1)`, "héll"},
+		{`join(chars("ab"), " ")`, "a b"},
+		{`format("%s=%d %v", "x", parse_int("7"), [1])`, "x=7 [1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, []int64{11, 12}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int64{3, 4}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, 10},
+		{`reduce([1, 2, 3], fn(acc, x) { acc * x }, 10)`, 60},
+		{`sort([3, 1, 2])`, []int64{1, 2, 3}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int64{3, 2, 1}},
+		{`map([[1], [2, 3]], len)`, []int64{1, 2}},
+		{`map([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`reduce([], fn(acc, x) { acc + x })`, "`reduce` of an empty array without initial value"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			arr, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(arr.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(arr.Elements))
+				continue
+			}
+			for i, value := range expected {
+				testIntegerObject(t, arr.Elements[i], value)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not error. got=%T", evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("message wrong. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func TestDefineMacros(t *testing.T) {
 	input := `
 let number = 1;
@@ -563,4 +1097,74 @@ let mymacro = macro(x, y) { x + y }
 	if macro.Body.String() != expectedBody {
 		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
 	}
-}
\ No newline at end of file
+}
+
+func TestEvalContextLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancelExpired()
+
+	loop := "let x = 0; while (true) { x = x + 1; }"
+	recursion := "let f = fn(n) { 1 + f(n + 1) }; f(0);"
+
+	tests := []struct {
+		ctx    context.Context
+		input  string
+		limits object.Limits
+		check  func(err error) bool
+	}{
+		{cancelled, loop, object.Limits{}, func(err error) bool {
+			var target *object.CancelledError
+			return errors.As(err, &target) && errors.Is(err, context.Canceled)
+		}},
+		{expired, loop, object.Limits{}, func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+		{context.Background(), loop, object.Limits{Instructions: 1000}, func(err error) bool {
+			var target *object.InstructionLimitError
+			return errors.As(err, &target) && target.Limit == 1000
+		}},
+		{context.Background(), recursion, object.Limits{CallDepth: 50}, func(err error) bool {
+			var target *object.CallDepthError
+			return errors.As(err, &target) && target.Limit == 50
+		}},
+		{context.Background(), loop, object.Limits{Objects: 500}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target) && target.Limit == 500
+		}},
+		{context.Background(), `let s = "x"; while (true) { s = s + s }`, object.Limits{Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+		{context.Background(), `range(10000000)`, object.Limits{Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+		{context.Background(), `repeat("x", 100000000)`, object.Limits{Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+	}
+
+	for i, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+
+		result, err := EvalContext(tt.ctx, program, env, tt.limits)
+		if result != nil || !tt.check(err) {
+			t.Errorf("tests[%d] - wrong result. got=%v, %v", i, result, err)
+		}
+		if env.Budget() != nil {
+			t.Errorf("tests[%d] - budget left in the environment", i)
+		}
+	}
+
+	// tail calls do not count as nested calls
+	program := parser.New(lexer.New("let f = fn(n) { if (n > 0) { f(n - 1) } else { n } }; f(100);")).ParseProgram()
+	result, err := EvalContext(context.Background(), program, object.NewEnvironment(), object.Limits{CallDepth: 2, Instructions: 10000})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testIntegerObject(t, result, 0)
+}
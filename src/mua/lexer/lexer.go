@@ -1,21 +1,53 @@
 package lexer
 
-import "mua/token"
+import (
+	"fmt"
+	"mua/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input		 string
 	position	 int		// current position in input (point to current char)
 	readPosition int		// current reading position (after current char)
 	char		 byte		// current char under examination
+
+	file		 string		// optional source file name
+	line		 int		// line of current char, start from 1
+	column		 int		// column of current char, start from 1
+
+	comments	 []token.Token	// skipped comments, kept for formatters or doc tools
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewWithFile(input, "")
+}
+
+// the file name is attached to the position of every token
+func NewWithFile(input string, file string) *Lexer {
+	l := &Lexer{input: input, file: file, line: 1}
 	l.readChar()
 	return l
 }
 
+// All comments skipped so far, in source order
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{File: l.file, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) readChar() {
+	if l.char == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.char = 0
 	} else {
@@ -33,10 +65,21 @@ func (l *Lexer) peekChar() byte {
 	}
 }
 
+// peekCharAt(1) is the same as peekChar()
+func (l *Lexer) peekCharAt(offset int) byte {
+	if l.position+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.position+offset]
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	if illegal, ok := l.skipTrivia(); !ok {
+		return illegal
+	}
+	pos := l.currentPosition()
 
 	switch l.char {
 	case '=':
@@ -72,13 +115,65 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.char)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.char)
+		// Check if it is `**`
+		if l.peekChar() == '*' {
+			ch := l.char
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: string(ch) + string(l.char)}
+		} else {
+			tok = newToken(token.ASTERISK, l.char)
+		}
 	case '/':
 		tok = newToken(token.SLASH, l.char)
+	case '%':
+		tok = newToken(token.PERCENT, l.char)
 	case '<':
-		tok = newToken(token.LESS, l.char)
+		// Check if it is `<=`
+		if l.peekChar() == '=' {
+			ch := l.char
+			l.readChar()
+			tok = token.Token{Type: token.LESS_EQ, Literal: string(ch) + string(l.char)}
+		} else {
+			tok = newToken(token.LESS, l.char)
+		}
 	case '>':
-		tok = newToken(token.GREATER, l.char)
+		// Check if it is `>=`
+		if l.peekChar() == '=' {
+			ch := l.char
+			l.readChar()
+			tok = token.Token{Type: token.GREATER_EQ, Literal: string(ch) + string(l.char)}
+		} else {
+			tok = newToken(token.GREATER, l.char)
+		}
+	case '&':
+		// only `&&`, there is no bitwise and
+		if l.peekChar() == '&' {
+			ch := l.char
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: string(ch) + string(l.char)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.char)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.char
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: string(ch) + string(l.char)}
+		} else {
+			tok = newToken(token.ILLEGAL, l.char)
+		}
+	case '?':
+		// only `??` and `?[`
+		switch l.peekChar() {
+		case '?':
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		case '[':
+			l.readChar()
+			tok = token.Token{Type: token.SAFE_INDEX, Literal: "?["}
+		default:
+			tok = newToken(token.ILLEGAL, l.char)
+		}
 	case '[':
 		tok = newToken(token.L_BRACKET, l.char)
 	case ']':
@@ -88,8 +183,19 @@ func (l *Lexer) NextToken() token.Token {
 	case '}':
 		tok = newToken(token.R_BRACE, l.char)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		str, err := l.readString()
+		if err != "" {
+			tok = token.Token{Type: token.ILLEGAL, Literal: err}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		}
+	case '`':
+		str, ok := l.readRawString()
+		if !ok {
+			tok = token.Token{Type: token.ILLEGAL, Literal: "unterminated raw string literal"}
+		} else {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		}
 
 	case 0:
 		tok.Type = token.EOF
@@ -98,16 +204,18 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.char) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			tok.Position = pos
 			return tok
 		} else if isDigit(l.char) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Position = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.char)
 		}
 	}
 	l.readChar()
+	tok.Position = pos
 	return tok
 }
 
@@ -117,6 +225,67 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// skip whitespaces and comments, fail on an unterminated block comment
+func (l *Lexer) skipTrivia() (token.Token, bool) {
+	for {
+		l.skipWhitespace()
+
+		if l.char != '/' {
+			return token.Token{}, true
+		}
+		switch l.peekChar() {
+		case '/':
+			l.readLineComment()
+		case '*':
+			pos := l.currentPosition()
+			if !l.readBlockComment() {
+				return token.Token{Type: token.ILLEGAL, Literal: "unterminated block comment", Position: pos}, false
+			}
+		default:
+			return token.Token{}, true
+		}
+	}
+}
+
+// `// comment` until the end of line
+func (l *Lexer) readLineComment() {
+	pos := l.currentPosition()
+	position := l.position
+	for l.char != '\n' && l.char != 0 {
+		l.readChar()
+	}
+	l.addComment(pos, l.input[position:l.position])
+}
+
+// `/* comment */`, block comments can be nested
+func (l *Lexer) readBlockComment() bool {
+	pos := l.currentPosition()
+	position := l.position
+	depth := 0
+	for {
+		switch {
+		case l.char == 0:
+			return false
+		case l.char == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.char == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			l.addComment(pos, l.input[position:l.position])
+			return true
+		}
+	}
+}
+
+func (l *Lexer) addComment(pos token.Position, literal string) {
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Position: pos})
+}
+
 func newToken(tokenType token.TokenType, char byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(char)}
 }
@@ -133,25 +302,129 @@ func isLetter(char byte) bool {
 	return 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || char == '_'
 }
 
-func (l *Lexer) readNumber() string {
+// 12, 1.5, 2e10, 6.02e-23
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	var tokenType token.TokenType = token.INT
 	position := l.position
+	l.readDigits()
+
+	// `1.` is not a float, the dot must be followed by digits
+	if l.char == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.char == 'e' || l.char == 'E' {
+		next := l.peekChar()
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(l.peekCharAt(2)) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if next == '+' || next == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	literal := l.input[position:l.position]
+	if tokenType == token.INT {
+		if _, err := strconv.ParseInt(literal, 10, 64); err != nil {
+			tokenType = token.BIGINT
+		}
+	}
+	return tokenType, literal
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.char) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
-} 
+}
 
 func isDigit(char byte) bool {
 	return '0' <= char && char <= '9'
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1		// skip the "
+// "hello\n", returns the unescaped value or an error message.
+// The whole literal is consumed even if an escape sequence is invalid.
+func (l *Lexer) readString() (string, string) {
+	var out strings.Builder
+	var err string
+
 	for {
 		l.readChar()
-		if l.char == '"' {
-			break
+		switch l.char {
+		case 0:
+			return "", "unterminated string literal"
+		case '"':
+			return out.String(), err
+		case '\\':
+			l.readChar()
+			if e := l.readEscape(&out); e != "" && err == "" {
+				err = e
+			}
+		default:
+			out.WriteByte(l.char)
 		}
 	}
-	return l.input[position:l.position]
-}
\ No newline at end of file
+}
+
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+}
+
+// the char after the backslash is under examination
+func (l *Lexer) readEscape(out *strings.Builder) string {
+	if ch, ok := escapes[l.char]; ok {
+		out.WriteByte(ch)
+		return ""
+	}
+	if l.char == 0 {
+		// readString meets the EOF again and reports it
+		return ""
+	}
+	if l.char != 'u' {
+		return fmt.Sprintf("unknown escape sequence \\%c", l.char)
+	}
+
+	// \u{1F600}
+	if l.peekChar() != '{' {
+		return "invalid unicode escape, expected \\u{...}"
+	}
+	l.readChar()
+	position := l.position + 1
+	for l.peekChar() != '}' {
+		if l.peekChar() == 0 || l.peekChar() == '"' {
+			return "invalid unicode escape, missing }"
+		}
+		l.readChar()
+	}
+	digits := l.input[position:l.readPosition]
+	l.readChar()
+
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+		return fmt.Sprintf("invalid unicode escape \\u{%s}", digits)
+	}
+	out.WriteRune(rune(code))
+	return ""
+}
+
+// `raw string`, no escapes and may span multiple lines
+func (l *Lexer) readRawString() (string, bool) {
+	position := l.position + 1		// skip the `
+	for {
+		l.readChar()
+		switch l.char {
+		case 0:
+			return "", false
+		case '`':
+			return l.input[position:l.position], true
+		}
+	}
+}
@@ -5,9 +5,21 @@ import (
 	"os"
 	"os/user"
 	"mua/repl"
+	"mua/runner"
 )
 
+// mua				start the REPL
+// mua file.mua [args...]	run a script
 func main() {
+	if len(os.Args) > 1 {
+		err := runner.RunFile(os.Args[1], os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,4 +28,4 @@ func main() {
 		user.Username)
 	fmt.Printf("Type \"help\" for more information.\n")
 	repl.Start(os.Stdin, os.Stdout)
-}
\ No newline at end of file
+}
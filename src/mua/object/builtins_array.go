@@ -0,0 +1,433 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// Array builtins never modify their arguments, they return new arrays
+
+// Builtins refuse to build arrays of more than 16M elements
+const maxArrayLength = 1 << 24
+
+func arrayArgument(name string, args []Object, i int) (*Array, *Error) {
+	arr, ok := args[i].(*Array)
+	if !ok {
+		return nil, newError("argument %d to `%s` must be ARRAY, got %s", i+1, name, args[i].Type())
+	}
+	return arr, nil
+}
+
+func integerArgument(name string, args []Object, i int) (int64, *Error) {
+	integer, ok := args[i].(*Integer)
+	if !ok {
+		return 0, newError("argument %d to `%s` must be INTEGER, got %s", i+1, name, args[i].Type())
+	}
+	return integer.Value, nil
+}
+
+func wrongNumberOfArguments(got int, want string) *Error {
+	return newError("wrong number of arguments. got=%d, want=%s", got, want)
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// The natural order of numbers and of strings
+func lessThan(left, right Object) (bool, error) {
+	result, err := Compare(left, right)
+	return result < 0, err
+}
+
+func indexOf(elements []Object, obj Object) int {
+	for i, element := range elements {
+		if Equal(element, obj) {
+			return i
+		}
+	}
+	return -1
+}
+
+func arrayFirst(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("first", args, 0)
+	if err != nil { return err }
+
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+	return nil
+}
+
+func arrayLast(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("last", args, 0)
+	if err != nil { return err }
+
+	if length := len(arr.Elements); length > 0 {
+		return arr.Elements[length-1]
+	}
+	return nil
+}
+
+// All elements but the first, null for an empty array
+func arrayRest(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("rest", args, 0)
+	if err != nil { return err }
+
+	if len(arr.Elements) == 0 {
+		return nil
+	}
+	elements := make([]Object, len(arr.Elements)-1)
+	copy(elements, arr.Elements[1:])
+	return &Array{Elements: elements}
+}
+
+func arrayPush(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	arr, err := arrayArgument("push", args, 0)
+	if err != nil { return err }
+
+	elements := make([]Object, len(arr.Elements), len(arr.Elements)+1)
+	copy(elements, arr.Elements)
+	return &Array{Elements: append(elements, args[1])}
+}
+
+// slice(arr, start[, end]), negative indices count from the end
+func arraySlice(args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongNumberOfArguments(len(args), "2 or 3")
+	}
+	arr, err := arrayArgument("slice", args, 0)
+	if err != nil { return err }
+
+	length := int64(len(arr.Elements))
+	start, err := integerArgument("slice", args, 1)
+	if err != nil { return err }
+	end := length
+	if len(args) == 3 {
+		end, err = integerArgument("slice", args, 2)
+		if err != nil { return err }
+	}
+	start, end = sliceBound(start, length), sliceBound(end, length)
+	if end < start {
+		end = start
+	}
+
+	elements := make([]Object, end-start)
+	copy(elements, arr.Elements[start:end])
+	return &Array{Elements: elements}
+}
+
+func sliceBound(index, length int64) int64 {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
+
+func arrayConcat(args ...Object) Object {
+	elements := []Object{}
+	for i := range args {
+		arr, err := arrayArgument("concat", args, i)
+		if err != nil { return err }
+		elements = append(elements, arr.Elements...)
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayReverse(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("reverse", args, 0)
+	if err != nil { return err }
+
+	length := len(arr.Elements)
+	elements := make([]Object, length)
+	for i, element := range arr.Elements {
+		elements[length-1-i] = element
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayContains(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	arr, err := arrayArgument("contains", args, 0)
+	if err != nil { return err }
+
+	return nativeBool(indexOf(arr.Elements, args[1]) >= 0)
+}
+
+// The index of the first equal element, -1 if there is none
+func arrayIndexOf(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	arr, err := arrayArgument("index_of", args, 0)
+	if err != nil { return err }
+
+	return &Integer{Value: int64(indexOf(arr.Elements, args[1]))}
+}
+
+// join(arr[, separator]), the elements are joined as they are printed
+func arrayJoin(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "1 or 2")
+	}
+	arr, err := arrayArgument("join", args, 0)
+	if err != nil { return err }
+
+	separator := ""
+	if len(args) == 2 {
+		str, ok := args[1].(*String)
+		if !ok {
+			return newError("argument 2 to `join` must be STRING, got %s", args[1].Type())
+		}
+		separator = str.Value
+	}
+
+	parts := make([]string, len(arr.Elements))
+	for i, element := range arr.Elements {
+		parts[i] = element.Inspect()
+	}
+	return &String{Value: strings.Join(parts, separator)}
+}
+
+// range(end), range(start, end) or range(start, end, step), end is excluded
+func arrayRange(args ...Object) Object {
+	start, step, count, err := rangeArguments(args)
+	if err != nil { return err }
+	if count > maxArrayLength {
+		return newError("`range` of %d elements is too long", count)
+	}
+
+	elements := make([]Object, count)
+	value := start
+	for i := range elements {
+		elements[i] = &Integer{Value: value}
+		value += step
+	}
+	return &Array{Elements: elements}
+}
+
+func rangeCost(args ...Object) int64 {
+	_, _, count, err := rangeArguments(args)
+	if err != nil || count > maxArrayLength {
+		return 0	// refused by arrayRange
+	}
+	return 1 + int64(count)
+}
+
+func rangeArguments(args []Object) (start, step int64, count uint64, err *Error) {
+	if len(args) < 1 || len(args) > 3 {
+		return 0, 0, 0, wrongNumberOfArguments(len(args), "1, 2 or 3")
+	}
+	bounds := []int64{0, 0, 1}
+	for i := range args {
+		value, err := integerArgument("range", args, i)
+		if err != nil { return 0, 0, 0, err }
+		bounds[i] = value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return 0, 0, 0, newError("step of `range` must not be 0")
+	}
+
+	// counted in uint64, the distance between two int64 may not fit in int64
+	if step > 0 && start < end {
+		count = (uint64(end) - uint64(start) - 1) / uint64(step) + 1
+	} else if step < 0 && start > end {
+		count = (uint64(start) - uint64(end) - 1) / -uint64(step) + 1
+	}
+	return start, step, count, nil
+}
+
+// Arrays of the elements at the same index, as long as the shortest argument
+func arrayZip(args ...Object) Object {
+	if len(args) == 0 {
+		return wrongNumberOfArguments(len(args), "at least 1")
+	}
+	arrays := make([]*Array, len(args))
+	length := -1
+	for i := range args {
+		arr, err := arrayArgument("zip", args, i)
+		if err != nil { return err }
+		if length < 0 || len(arr.Elements) < length {
+			length = len(arr.Elements)
+		}
+		arrays[i] = arr
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		tuple := make([]Object, len(arrays))
+		for j, arr := range arrays {
+			tuple[j] = arr.Elements[i]
+		}
+		elements[i] = &Array{Elements: tuple}
+	}
+	return &Array{Elements: elements}
+}
+
+// Flatten arrays nested one level deep
+func arrayFlatten(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("flatten", args, 0)
+	if err != nil { return err }
+
+	elements := []Object{}
+	for _, element := range arr.Elements {
+		if inner, ok := element.(*Array); ok {
+			elements = append(elements, inner.Elements...)
+		} else {
+			elements = append(elements, element)
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+// The first occurrence of every element, in order
+func arrayUnique(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	arr, err := arrayArgument("unique", args, 0)
+	if err != nil { return err }
+
+	elements := []Object{}
+	for _, element := range arr.Elements {
+		if indexOf(elements, element) < 0 {
+			elements = append(elements, element)
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayMap(caller Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	arr, err := arrayArgument("map", args, 0)
+	if err != nil { return err }
+
+	elements := make([]Object, len(arr.Elements))
+	for i, element := range arr.Elements {
+		result, err := caller.Call(args[1], element)
+		if err != nil {
+			return newError("%s", err)
+		}
+		elements[i] = result
+	}
+	return &Array{Elements: elements}
+}
+
+func arrayFilter(caller Caller, args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	arr, err := arrayArgument("filter", args, 0)
+	if err != nil { return err }
+
+	elements := []Object{}
+	for _, element := range arr.Elements {
+		result, err := caller.Call(args[1], element)
+		if err != nil {
+			return newError("%s", err)
+		}
+		if isTruthy(result) {
+			elements = append(elements, element)
+		}
+	}
+	return &Array{Elements: elements}
+}
+
+// reduce(arr, fn[, initial]), without initial the first element is used
+func arrayReduce(caller Caller, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongNumberOfArguments(len(args), "2 or 3")
+	}
+	arr, err := arrayArgument("reduce", args, 0)
+	if err != nil { return err }
+
+	elements := arr.Elements
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else if len(elements) > 0 {
+		acc, elements = elements[0], elements[1:]
+	} else {
+		return newError("`reduce` of an empty array without initial value")
+	}
+
+	for _, element := range elements {
+		result, err := caller.Call(args[1], acc, element)
+		if err != nil {
+			return newError("%s", err)
+		}
+		acc = result
+	}
+	return acc
+}
+
+// sort(arr) sorts numbers or strings, sort(arr, less) calls less(a, b)
+func arraySort(caller Caller, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "1 or 2")
+	}
+	arr, errObj := arrayArgument("sort", args, 0)
+	if errObj != nil { return errObj }
+
+	elements := make([]Object, len(arr.Elements))
+	copy(elements, arr.Elements)
+
+	var err error
+	sort.SliceStable(elements, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		if len(args) == 1 {
+			var less bool
+			less, err = lessThan(elements[i], elements[j])
+			return less
+		}
+		var result Object
+		result, err = caller.Call(args[1], elements[i], elements[j])
+		return err == nil && isTruthy(result)
+	})
+	if err != nil {
+		return newError("%s", err)
+	}
+	return &Array{Elements: elements}
+}
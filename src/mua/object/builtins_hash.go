@@ -0,0 +1,112 @@
+package object
+
+// Hash builtins never modify their arguments, they return new hashes.
+// Results follow the insertion order of the hashes
+
+func hashArgument(name string, args []Object, i int) (*Hash, *Error) {
+	hash, ok := args[i].(*Hash)
+	if !ok {
+		return nil, newError("argument %d to `%s` must be HASH, got %s", i+1, name, args[i].Type())
+	}
+	return hash, nil
+}
+
+func keyArgument(name string, args []Object, i int) (Hashable, *Error) {
+	key, ok := AsHashable(args[i])
+	if !ok {
+		return nil, newError("argument %d to `%s` is unusable as hash key: %s", i+1, name, args[i].Type())
+	}
+	return key, nil
+}
+
+func copyHash(hash *Hash) *Hash {
+	result := &Hash{}
+	for _, pair := range hash.Pairs() {
+		result.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return result
+}
+
+func hashKeys(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	hash, err := hashArgument("keys", args, 0)
+	if err != nil { return err }
+
+	keys := []Object{}
+	for _, pair := range hash.Pairs() {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}
+}
+
+func hashValues(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	hash, err := hashArgument("values", args, 0)
+	if err != nil { return err }
+
+	values := []Object{}
+	for _, pair := range hash.Pairs() {
+		values = append(values, pair.Value)
+	}
+	return &Array{Elements: values}
+}
+
+// The pairs as arrays of [key, value]
+func hashItems(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	hash, err := hashArgument("items", args, 0)
+	if err != nil { return err }
+
+	items := []Object{}
+	for _, pair := range hash.Pairs() {
+		items = append(items, &Array{Elements: []Object{pair.Key, pair.Value}})
+	}
+	return &Array{Elements: items}
+}
+
+func hashHasKey(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	hash, err := hashArgument("has_key", args, 0)
+	if err != nil { return err }
+	key, err := keyArgument("has_key", args, 1)
+	if err != nil { return err }
+
+	_, ok := hash.Get(key)
+	return nativeBool(ok)
+}
+
+// A copy of the hash without the key
+func hashDelete(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	hash, err := hashArgument("delete", args, 0)
+	if err != nil { return err }
+	key, err := keyArgument("delete", args, 1)
+	if err != nil { return err }
+
+	result := copyHash(hash)
+	result.Delete(key)
+	return result
+}
+
+// The pairs of all hashes, a later hash overrides the values of the earlier ones
+func hashMerge(args ...Object) Object {
+	result := &Hash{}
+	for i := range args {
+		hash, err := hashArgument("merge", args, i)
+		if err != nil { return err }
+		for _, pair := range hash.Pairs() {
+			result.Set(pair.Key.(Hashable), pair.Value)
+		}
+	}
+	return result
+}
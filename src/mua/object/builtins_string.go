@@ -0,0 +1,270 @@
+package object
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+)
+
+// Indices of string builtins count characters, not bytes
+
+// Builtins refuse to build strings longer than 256MB
+const maxStringLength = 1 << 28
+
+func stringArgument(name string, args []Object, i int) (string, *Error) {
+	str, ok := args[i].(*String)
+	if !ok {
+		return "", newError("argument %d to `%s` must be STRING, got %s", i+1, name, args[i].Type())
+	}
+	return str.Value, nil
+}
+
+// split(s[, separator]), without separator s is split around white space
+func stringSplit(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "1 or 2")
+	}
+	str, err := stringArgument("split", args, 0)
+	if err != nil { return err }
+
+	var parts []string
+	if len(args) == 2 {
+		separator, err := stringArgument("split", args, 1)
+		if err != nil { return err }
+		parts = strings.Split(str, separator)
+	} else {
+		parts = strings.Fields(str)
+	}
+
+	elements := make([]Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &String{Value: part}
+	}
+	return &Array{Elements: elements}
+}
+
+// A builtin of a function mapping one string to another
+func stringFunction(name string, fn func(string) string) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 1 {
+			return wrongNumberOfArguments(len(args), "1")
+		}
+		str, err := stringArgument(name, args, 0)
+		if err != nil { return err }
+
+		return &String{Value: fn(str)}
+	}
+}
+
+func stringReplace(args ...Object) Object {
+	if len(args) != 3 {
+		return wrongNumberOfArguments(len(args), "3")
+	}
+	values := make([]string, 3)
+	for i := range args {
+		value, err := stringArgument("replace", args, i)
+		if err != nil { return err }
+		values[i] = value
+	}
+	return &String{Value: strings.Replace(values[0], values[1], values[2], -1)}
+}
+
+// A builtin of a predicate on two strings
+func stringPredicate(name string, fn func(string, string) bool) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 2 {
+			return wrongNumberOfArguments(len(args), "2")
+		}
+		str, err := stringArgument(name, args, 0)
+		if err != nil { return err }
+		other, err := stringArgument(name, args, 1)
+		if err != nil { return err }
+
+		return nativeBool(fn(str, other))
+	}
+}
+
+// contains(s, substring) or contains(arr, element)
+func builtinContains(args ...Object) Object {
+	if len(args) == 2 && args[0].Type() == STRING_OBJ {
+		return stringPredicate("contains", strings.Contains)(args...)
+	}
+	return arrayContains(args...)
+}
+
+// The index of the first occurrence of the substring, -1 if there is none
+func stringFind(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	str, err := stringArgument("find", args, 0)
+	if err != nil { return err }
+	substring, err := stringArgument("find", args, 1)
+	if err != nil { return err }
+
+	index := strings.Index(str, substring)
+	if index > 0 {
+		index = len([]rune(str[:index]))
+	}
+	return &Integer{Value: int64(index)}
+}
+
+func stringRepeat(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	str, err := stringArgument("repeat", args, 0)
+	if err != nil { return err }
+	count, err := integerArgument("repeat", args, 1)
+	if err != nil { return err }
+
+	if count < 0 {
+		return newError("count of `repeat` must not be negative, got %d", count)
+	}
+	if len(str) > 0 && count > maxStringLength / int64(len(str)) {
+		return newError("result of `repeat` is too long")
+	}
+	return &String{Value: strings.Repeat(str, int(count))}
+}
+
+func repeatCost(args ...Object) int64 {
+	if len(args) != 2 {
+		return 0
+	}
+	str, ok := args[0].(*String)
+	count, ok2 := args[1].(*Integer)
+	if !ok || !ok2 || count.Value < 0 {
+		return 0
+	}
+	if len(str.Value) > 0 && count.Value > maxStringLength / int64(len(str.Value)) {
+		return 0	// refused by stringRepeat
+	}
+	return StringCost(int64(len(str.Value)) * count.Value)
+}
+
+func stringChars(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	str, err := stringArgument("chars", args, 0)
+	if err != nil { return err }
+
+	elements := []Object{}
+	for _, ch := range str {
+		elements = append(elements, &String{Value: string(ch)})
+	}
+	return &Array{Elements: elements}
+}
+
+// substr(s, start[, end]), negative indices count from the end like in slice
+func stringSubstr(args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return wrongNumberOfArguments(len(args), "2 or 3")
+	}
+	str, err := stringArgument("substr", args, 0)
+	if err != nil { return err }
+
+	chars := []rune(str)
+	length := int64(len(chars))
+	start, err := integerArgument("substr", args, 1)
+	if err != nil { return err }
+	end := length
+	if len(args) == 3 {
+		end, err = integerArgument("substr", args, 2)
+		if err != nil { return err }
+	}
+	start, end = sliceBound(start, length), sliceBound(end, length)
+	if end < start {
+		end = start
+	}
+	return &String{Value: string(chars[start:end])}
+}
+
+// format(template, args...) replaces %d with an integer, %s with a
+// string, %v with any value as it is printed and %% with %
+func stringFormat(args ...Object) Object {
+	if len(args) < 1 {
+		return wrongNumberOfArguments(len(args), "at least 1")
+	}
+	template, err := stringArgument("format", args, 0)
+	if err != nil { return err }
+
+	var out bytes.Buffer
+	next := 1
+	chars := []rune(template)
+	for i := 0; i < len(chars); i++ {
+		if chars[i] != '%' {
+			out.WriteRune(chars[i])
+			continue
+		}
+		if i+1 == len(chars) {
+			return newError("`format` ends with an incomplete verb")
+		}
+		i++
+		verb := chars[i]
+		if verb == '%' {
+			out.WriteRune('%')
+			continue
+		}
+		if next >= len(args) {
+			return newError("missing argument for %%%c in `format`", verb)
+		}
+
+		arg := args[next]
+		next++
+		switch verb {
+		case 'd':
+			if !IsInteger(arg) {
+				return newError("%%d in `format` needs INTEGER, got %s", arg.Type())
+			}
+			out.WriteString(arg.Inspect())
+		case 's':
+			str, ok := arg.(*String)
+			if !ok {
+				return newError("%%s in `format` needs STRING, got %s", arg.Type())
+			}
+			out.WriteString(str.Value)
+		case 'v':
+			out.WriteString(arg.Inspect())
+		default:
+			return newError("unknown verb %%%c in `format`", verb)
+		}
+	}
+	if next < len(args) {
+		return newError("too many arguments for `format`. got=%d, want=%d", len(args)-1, next-1)
+	}
+	return &String{Value: out.String()}
+}
+
+func toString(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+	return &String{Value: args[0].Inspect()}
+}
+
+// parse_int(s[, base]), the base is 10 by default
+func parseInt(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "1 or 2")
+	}
+	str, err := stringArgument("parse_int", args, 0)
+	if err != nil { return err }
+	base := int64(10)
+	if len(args) == 2 {
+		base, err = integerArgument("parse_int", args, 1)
+		if err != nil { return err }
+		if base < 2 || base > 36 {
+			return newError("base of `parse_int` must be between 2 and 36, got %d", base)
+		}
+	}
+
+	value, ok := new(big.Int).SetString(strings.TrimSpace(str), int(base))
+	if !ok {
+		return newError("cannot parse %q as integer", str)
+	}
+	return NewInteger(value)
+}
@@ -14,6 +14,8 @@ func NewEnvironment() *Environment {
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	budget *Budget		// of the running evaluation, set on the outermost environment
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -28,4 +30,29 @@ func (e *Environment) Get(name string) (Object, bool) {
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
-}
\ No newline at end of file
+}
+
+// Update an existing variable in the scope where it is defined
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+// The budget of the closest environment that has one, nil if unlimited
+func (e *Environment) Budget() *Budget {
+	for env := e; env != nil; env = env.outer {
+		if env.budget != nil {
+			return env.budget
+		}
+	}
+	return nil
+}
+
+func (e *Environment) SetBudget(b *Budget) {
+	e.budget = b
+}
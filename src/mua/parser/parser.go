@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"mua/ast"
 	"mua/lexer"
 	"mua/token"
@@ -11,26 +12,40 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN			// x = y
+	NULLISH			// x ?? y
+	LOGICAL_OR		// ||
+	LOGICAL_AND		// &&
 	EQUALS			// ==
-	LESSGREATER		// < or >
+	LESSGREATER		// <, >, <= or >=
 	SUM				// + or -
-	PRODUCT			// * or /
+	PRODUCT			// *, / or %
 	PREFIX			// -x or !x
+	POWER			// x ** y, so -x ** y is -(x ** y)
 	CALL			// myFunc(args)
 	INDEX			// array[index]	
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN:	 ASSIGN,
 	token.EQUAL:	 EQUALS,
 	token.NOT_EQ:	 EQUALS,
 	token.LESS:		 LESSGREATER,
 	token.GREATER:	 LESSGREATER,
+	token.LESS_EQ:	 LESSGREATER,
+	token.GREATER_EQ: LESSGREATER,
+	token.NULLISH:	 NULLISH,
+	token.AND:		 LOGICAL_AND,
+	token.OR:		 LOGICAL_OR,
 	token.PLUS:		 SUM,
 	token.MINUS:	 SUM,
 	token.SLASH:	 PRODUCT,
 	token.ASTERISK:  PRODUCT,
+	token.PERCENT:	 PRODUCT,
+	token.POWER:	 POWER,
 	token.L_PAREN:   CALL,
 	token.L_BRACKET: INDEX,
+	token.SAFE_INDEX: INDEX,
 }
 
 type (
@@ -47,6 +62,8 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	loopDepth int		// break and continue are only allowed inside loops
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -60,6 +77,8 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefix(token.ID, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.BIGINT, p.parseBigIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.L_BRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.L_BRACE, p.parseHashLiteral)
@@ -67,17 +86,23 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.L_PAREN, p.parseGroupExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	
 	for _, tok := range []token.TokenType{token.PLUS, token.MINUS, token.SLASH,
-		token.ASTERISK, token.EQUAL, token.NOT_EQ, token.LESS, token.GREATER} {
+		token.ASTERISK, token.EQUAL, token.NOT_EQ, token.LESS, token.GREATER,
+		token.LESS_EQ, token.GREATER_EQ, token.AND, token.OR, token.PERCENT, token.POWER,
+		token.NULLISH} {
 		p.registerInfix(tok, p.parseInfixExpression)
 	}
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.L_PAREN, p.parseCallExpression)
 	p.registerInfix(token.L_BRACKET, p.parseIndexExpression)
+	p.registerInfix(token.SAFE_INDEX, p.parseIndexExpression)
 	
 	// Next twice, set currToken and peekToken.
 	p.nextToken()
@@ -112,10 +137,18 @@ func (p *Parser) currPrecedence() int {
 	return LOWEST
 }
 
+// errors are prefixed with the position of the offending token
+func (p *Parser) addError(pos token.Position, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if pos.IsValid() {
+		msg = pos.String() + ": " + msg
+	}
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.addError(p.peekToken.Position, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) nextToken() {
@@ -140,6 +173,12 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
+// the lexer reports what went wrong in the literal of an ILLEGAL token
+func (p *Parser) parseIllegal() ast.Expression {
+	p.addError(p.currToken.Position, "illegal token: %s", p.currToken.Literal)
+	return nil
+}
+
 // foobar;
 func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
@@ -150,8 +189,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currToken}
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currToken.Position, "could not parse %q as integer", p.currToken.Literal)
 		return nil
 	}
 	
@@ -159,11 +197,39 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return literal
 }
 
+// 9223372036854775808;
+func (p *Parser) parseBigIntegerLiteral() ast.Expression {
+	value, ok := new(big.Int).SetString(p.currToken.Literal, 10)
+	if !ok {
+		p.addError(p.currToken.Position, "could not parse %q as integer", p.currToken.Literal)
+		return nil
+	}
+	return &ast.BigIntegerLiteral{Token: p.currToken, Value: value}
+}
+
+// 3.14;
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currToken}
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
+	if err != nil {
+		p.addError(p.currToken.Position, "could not parse %q as float", p.currToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+	return literal
+}
+
 // true;
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.currToken, Value: p.currTokenIs(token.TRUE)}
 }
 
+// null;
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.currToken}
+}
+
 func (p *Parser) parseGroupExpression() ast.Expression {
 	p.nextToken()
 
@@ -186,9 +252,9 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	return array
 }
 
-// myArray[2]
+// myArray[2], maybeArray?[2]
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	expr := &ast.IndexExpression{Token: p.currToken, Left: left}
+	expr := &ast.IndexExpression{Token: p.currToken, Left: left, Safe: p.currTokenIs(token.SAFE_INDEX)}
 	p.nextToken()
 	expr.Index = p.parseExpression(LOWEST)
 
@@ -230,6 +296,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.R_BRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -264,12 +331,41 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left: left,
 	}
 	precedence := p.currPrecedence()
+	if expression.Token.Type == token.POWER {
+		// right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
 	return expression
 }
 
+// x = 5; array[0] = x;
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{Token: p.currToken, Target: target}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+	case *ast.IndexExpression:
+		if target.Safe {
+			p.addError(p.currToken.Position, "cannot assign to %s", target.String())
+			return nil
+		}
+	case nil:
+		return nil
+	default:
+		p.addError(p.currToken.Position, "cannot assign to %s", target.String())
+		return nil
+	}
+
+	p.nextToken()
+	// right associative, a = b = 5 is a = (b = 5)
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
@@ -290,6 +386,12 @@ func (p *Parser) ParseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	case token.SEMICOLON:
 		return nil
 	default:
@@ -312,6 +414,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -334,6 +439,80 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// while (<cond>) { <body> }
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.currToken}
+	if !p.expectPeek(token.L_PAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.R_PAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.L_BRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+// for (<id> in <iterable>) { <body> }
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.currToken}
+	if !p.expectPeek(token.L_PAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.ID) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.R_PAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.L_BRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+// break; continue;
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var stmt ast.Statement
+	if p.currTokenIs(token.BREAK) {
+		stmt = &ast.BreakStatement{Token: p.currToken}
+	} else {
+		stmt = &ast.ContinueStatement{Token: p.currToken}
+	}
+
+	if p.loopDepth == 0 {
+		p.addError(p.currToken.Position, "%s outside of a loop", p.currToken.Literal)
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // if <cond> <conseq> else <alternative>
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.currToken}
@@ -379,8 +558,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for `%s` found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.currToken.Position, "no prefix parse function for `%s` found", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -411,6 +589,11 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	p.nextToken()
 
 	for !p.currTokenIs(token.R_BRACE) {
+		if p.currTokenIs(token.EOF) {
+			p.addError(p.currToken.Position, "expected next token to be }, got EOF instead")
+			return block
+		}
+
 		stmt := p.ParseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
@@ -431,7 +614,13 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.L_BRACE) {
 		return nil
 	}
+
+	// a loop outside the function can't be left from its body
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	literal.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
+
 	return literal
 }
 
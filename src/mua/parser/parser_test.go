@@ -248,6 +248,34 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5", 0.5},
+		{"2e3", 2000},
+		{"1.5e-2", 0.015},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("expression is not FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal value is not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -452,6 +480,10 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -527,6 +559,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
 		},
+		{
+			"a < b || c >= d && e",
+			"((a < b) || ((c >= d) && e))",
+		},
+		{
+			"a == b && c != d || !e",
+			"(((a == b) && (c != d)) || (!e))",
+		},
+		{
+			"x = a <= b",
+			"(x = (a <= b))",
+		},
 		{
 			"3 + 4; - 5 * 5",
 			"(3 + 4)((-5) * 5)",
@@ -583,6 +627,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a * b ** c ** d",
+			"(a * (b ** (c ** d)))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** -b * c",
+			"((a ** (-b)) * c)",
+		},
+		{
+			"a ?? b || c",
+			"(a ?? (b || c))",
+		},
+		{
+			"a ?? b ?? null",
+			"((a ?? b) ?? null)",
+		},
+		{
+			"a?[1][2] ?? -1",
+			"(((a?[1])[2]) ?? (-1))",
+		},
+		{
+			"f(x)?[k + 1]",
+			"(f(x)?[(k + 1)])",
+		},
 	}
 
 	for _, tt := range tests {
@@ -706,7 +782,7 @@ func TestIfElseExpression(t *testing.T) {
 		t.Errorf("expr.Alternative.Statements was nil.")
 	}
 	if len(expr.Alternative.Statements) != 1 {
-		t.Errorf("exp.Alternative.Statements got=%q statements. expected=%d", 
+		t.Errorf("exp.Alternative.Statements got=%d statements. expected=%d", 
 			len(expr.Alternative.Statements), 1)
 	}
 	alternative, ok := expr.Alternative.Statements[0].(*ast.ExpressionStatement)
@@ -757,6 +833,43 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestFunctionLiteralWithName(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedName string
+	}{
+		{`let myFunction = fn() { };`, "myFunction"},
+		{`let x = fn() { }();`, ""},
+		{`fn() { };`, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var function *ast.FunctionLiteral
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			function, _ = stmt.Value.(*ast.FunctionLiteral)
+		case *ast.ExpressionStatement:
+			function, _ = stmt.Expression.(*ast.FunctionLiteral)
+		}
+		if tt.expectedName == "" {
+			if function != nil && function.Name != "" {
+				t.Errorf("function literal name wrong. want empty, got=%q", function.Name)
+			}
+			continue
+		}
+		if function == nil {
+			t.Fatalf("expected *ast.FunctionLiteral for %q", tt.input)
+		}
+		if function.Name != tt.expectedName {
+			t.Errorf("function literal name wrong. want=%q, got=%q", tt.expectedName, function.Name)
+		}
+	}
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -856,4 +969,147 @@ func TestMacroLiteralParsing(t *testing.T) {
 			macro.Body.Statements[0])
 	}
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
-}
\ No newline at end of file
+}
+
+func TestParserErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\nadd(1, 2;", "2:9: expected next token to be ), got ; instead"},
+		{"\n  let = 5;", "2:7: expected next token to be ID, got = instead"},
+		{"let x = 1; /* oops", "1:12: illegal token: unterminated block comment"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestWhileStatementParsing(t *testing.T) {
+	input := `while (x < 10) { x; break; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements count wrong. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body statements count wrong. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.BreakStatement); !ok {
+		t.Errorf("body.Statements[1] is not ast.BreakStatement. got=%T", stmt.Body.Statements[1])
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[2] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[2])
+	}
+}
+
+func TestForStatementParsing(t *testing.T) {
+	input := `for (x in [1, 2]) { puts(x) }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if _, ok := stmt.Iterable.(*ast.ArrayLiteral); !ok {
+		t.Errorf("iterable is not ast.ArrayLiteral. got=%T", stmt.Iterable)
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body statements count wrong. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"if (true) { continue }", "1:13: continue outside of a loop"},
+		{"while (true) { fn() { break; } }", "1:23: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %q, got=%d", tt.input, len(errors))
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = x + 1", "(x = (x + 1))"},
+		{"a = b = 3", "(a = (b = 3))"},
+		{"arr[0] = 5 * 2", "((arr[0]) = (5 * 2))"},
+		{`h["k"] = v == 1`, "((h[k]) = (v == 1))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.AssignExpression); !ok {
+			t.Fatalf("expression is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("1 + 2 = 3"))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "1:7: cannot assign to (1 + 2)" {
+		t.Errorf("wrong errors for invalid assignment target. got=%q", errors)
+	}
+
+	p = New(lexer.New("a?[0] = 1"))
+	p.ParseProgram()
+	errors = p.Errors()
+	if len(errors) == 0 || errors[0] != "1:7: cannot assign to (a?[0])" {
+		t.Errorf("wrong errors for assignment to a safe index. got=%q", errors)
+	}
+}
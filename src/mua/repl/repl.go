@@ -41,7 +41,7 @@ func Start(in io.Reader, out io.Writer) {
 		expanded := evaluator.ExpandMacros(program, macroEnv)
 
 		evaluated := evaluator.Eval(expanded, env)
-		if evaluated != nil {
+		if evaluated != nil && (evaluated.Type() == object.ERROR_OBJ || endsWithExpression(program)) {
 			io.WriteString(out, evaluated.Inspect() + "\n")
 		}
 	}
@@ -61,4 +61,13 @@ func printParserErrors(out io.Writer, errors []string) {
 
 func printStatements(out io.Writer, program *ast.Program) {
 	io.WriteString(out, program.String() + "\n")
-}
\ No newline at end of file
+}
+
+// Only a line ending with an expression has a value to print
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
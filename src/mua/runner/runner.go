@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mua/evaluator"
+	"mua/lexer"
+	"mua/object"
+	"mua/parser"
+	"strings"
+)
+
+// All parser errors of a script
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+func RunFile(path string, args []string) error {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return Run(string(input), path, args)
+}
+
+// Lex, parse, expand macros and evaluate a whole script, the script
+// arguments are exposed to the program as the global array `args`
+func Run(input string, file string, args []string) error {
+	l := lexer.NewWithFile(input, file)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &ParseError{Errors: p.Errors()}
+	}
+
+	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	env.Set("args", argsArray(args))
+
+	evaluator.DefineMacros(program, macroEnv)
+	expanded := evaluator.ExpandMacros(program, macroEnv)
+
+	evaluated := evaluator.Eval(expanded, env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		if errObj.Pos.IsValid() {
+			return fmt.Errorf("runtime error: %s: %s", errObj.Pos, errObj.Message)
+		}
+		return fmt.Errorf("runtime error: %s", errObj.Message)
+	}
+	return nil
+}
+
+func argsArray(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	input := `
+	let sum = 0;
+	for (arg in args) { sum = sum + len(arg); }
+	if (sum != 5) { sum + true; }
+	`
+	if err := Run(input, "sum.mua", []string{"ab", "cde"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = ;", "parse error:\n\tscript.mua:1:9: no prefix parse function for `;` found"},
+		{"if (true) { 1", "parse error:\n\tscript.mua:1:14: expected next token to be }, got EOF instead"},
+		{"let x = 1;\n1 + true", "runtime error: script.mua:2:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn() { -true };\nf()", "runtime error: script.mua:1:16: unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		err := Run(tt.input, "script.mua", nil)
+		if err == nil {
+			t.Fatalf("expected error for %q but resulted in none.", tt.input)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected prefix=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRunFileNotFound(t *testing.T) {
+	if err := RunFile("no/such/file.mua", nil); err == nil {
+		t.Fatalf("expected error but resulted in none.")
+	}
+}
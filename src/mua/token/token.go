@@ -1,19 +1,42 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+// Position locates a token in the source, Line and Column start from 1
+type Position struct {
+    File   string       // optional, empty for REPL input
+    Line   int
+    Column int
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// file:line:column, or line:column without a file name
+func (p Position) String() string {
+    if p.File != "" {
+        return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+    }
+    return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 type Token struct {
     Type    TokenType
     Literal string
+    Position
 }
 
 const (
     ILLEGAL = "ILLEGAL"
     EOF     = "EOF"
+    COMMENT = "COMMENT"     // trivia, never passed to the parser
     
     // Identifier and Literals
     ID  = "ID"
     INT = "INT"
+    BIGINT = "BIGINT"     // an integer literal out of the int64 range
+    FLOAT = "FLOAT"
     STRING = "STRING"
 
     // Operators
@@ -23,13 +46,23 @@ const (
     BANG     = "!"
     ASTERISK = "*"
     SLASH    = "/"
+    PERCENT  = "%"
+    POWER    = "**"
 
     LESS    = "<"
     GREATER = ">"
+    LESS_EQ    = "<="
+    GREATER_EQ = ">="
 
     EQUAL  = "==" 
     NOT_EQ = "!="
 
+    AND = "&&"
+    OR  = "||"
+
+    NULLISH    = "??"     // a ?? b, b if a is null
+    SAFE_INDEX = "?["     // a?[k], null if a is null
+
     // Delimiters
     COMMA     = ","
     SEMICOLON = ";"
@@ -52,6 +85,13 @@ const (
     ELSE  = "ELSE"
     TRUE  = "TRUE"
     FALSE = "FALSE"
+    NULL  = "NULL"
+
+    WHILE    = "WHILE"
+    FOR      = "FOR"
+    IN       = "IN"
+    BREAK    = "BREAK"
+    CONTINUE = "CONTINUE"
 )
 
 var keywords = map[string]TokenType {
@@ -62,7 +102,13 @@ var keywords = map[string]TokenType {
     "else": ELSE,
     "true": TRUE,
     "false": FALSE,
+    "null": NULL,
     "macro": MACRO,
+    "while": WHILE,
+    "for": FOR,
+    "in": IN,
+    "break": BREAK,
+    "continue": CONTINUE,
 }
 
 func LookupIdentifier(ident string) TokenType {
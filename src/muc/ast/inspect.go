@@ -0,0 +1,81 @@
+package ast
+
+/**
+Visit the node and then its children in source order (hash pairs in map
+order), like go/ast.Inspect.
+The children are skipped when `visit` returns false.
+*/
+func Inspect(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, statement := range node.Statements {
+			Inspect(statement, visit)
+		}
+	case *BlockStatement:
+		for _, statement := range node.Statements {
+			Inspect(statement, visit)
+		}
+	case *ExpressionStatement:
+		Inspect(node.Expression, visit)
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, visit)
+	case *LetStatement:
+		Inspect(node.Name, visit)
+		Inspect(node.Value, visit)
+
+	case *IfExpression:
+		Inspect(node.Condition, visit)
+		Inspect(node.Consequence, visit)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, visit)
+		}
+	case *WhileStatement:
+		Inspect(node.Condition, visit)
+		Inspect(node.Body, visit)
+	case *ForStatement:
+		Inspect(node.Variable, visit)
+		Inspect(node.Iterable, visit)
+		Inspect(node.Body, visit)
+
+	case *PrefixExpression:
+		Inspect(node.Right, visit)
+	case *InfixExpression:
+		Inspect(node.Left, visit)
+		Inspect(node.Right, visit)
+	case *AssignExpression:
+		Inspect(node.Target, visit)
+		Inspect(node.Value, visit)
+	case *IndexExpression:
+		Inspect(node.Left, visit)
+		Inspect(node.Index, visit)
+	case *CallExpression:
+		Inspect(node.Function, visit)
+		for _, argument := range node.Arguments {
+			Inspect(argument, visit)
+		}
+
+	case *FunctionLiteral:
+		for _, parameter := range node.Parameters {
+			Inspect(parameter, visit)
+		}
+		Inspect(node.Body, visit)
+	case *MacroLiteral:
+		for _, parameter := range node.Parameters {
+			Inspect(parameter, visit)
+		}
+		Inspect(node.Body, visit)
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			Inspect(element, visit)
+		}
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			Inspect(key, visit)
+			Inspect(node.Pairs[key], visit)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	id := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	// let f = fn(a) { while (a) { a = g(a, [b]) } }; for (x in f) { -x[c] }
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: id("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{id("a")},
+					Body: &BlockStatement{Statements: []Statement{
+						&WhileStatement{
+							Condition: id("a"),
+							Body: &BlockStatement{Statements: []Statement{
+								&ExpressionStatement{Expression: &AssignExpression{
+									Target: id("a"),
+									Value: &CallExpression{
+										Function: id("g"),
+										Arguments: []Expression{id("a"), &ArrayLiteral{Elements: []Expression{id("b")}}},
+									},
+								}},
+							}},
+						},
+					}},
+				},
+			},
+			&ForStatement{
+				Variable: id("x"),
+				Iterable: id("f"),
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &PrefixExpression{
+						Operator: "-",
+						Right: &IndexExpression{Left: id("x"), Index: id("c")},
+					}},
+				}},
+			},
+		},
+	}
+
+	names := []string{}
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	expected := []string{"f", "a", "a", "a", "g", "a", "b", "x", "f", "x", "c"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong visiting order. want=%v, got=%v", expected, names)
+	}
+
+	// skip the function bodies
+	names = []string{}
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+	expected = []string{"f", "x", "f", "x", "c"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong visiting order. want=%v, got=%v", expected, names)
+	}
+}
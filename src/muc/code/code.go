@@ -13,21 +13,40 @@ func (ins Instructions) String() string {
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		def, operands, width, err := ins.Decode(i)
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
-			continue
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			break
 		}
 
-		operands, offset := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		
-		i += 1 + offset
+		i += width
 	}
 
 	return out.String()
 }
 
+// Decode the instruction starting at offset i, returns its definition,
+// operands and the width of the whole instruction
+func (ins Instructions) Decode(i int) (*Definition, []int, int, error) {
+	def, err := Lookup(ins[i])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if i + width > len(ins) {
+		return nil, nil, 0, fmt.Errorf("operands of %s truncated", def.Name)
+	}
+
+	operands, _ := ReadOperands(def, ins[i+1:])
+	return def, operands, width, nil
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -67,6 +86,7 @@ const (
 	OpEqual
 	OpNotEqual
 	OpGreaterThan
+	OpGreaterEqual
 
 	OpMinus
 	OpBang
@@ -88,6 +108,21 @@ const (
 
 	OpClosure
 	OpGetFree
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpSetIndex
+
+	OpIter
+	OpIterNext
+
+	OpCurrentClosure
+	OpTailCall
+
+	OpMod
+	OpPow
+
+	OpJumpNotNull
 )
 
 type Definition struct {
@@ -113,6 +148,7 @@ var definitions = map[Opcode]*Definition{
 	OpEqual: {"OpEqual", []int{}},
 	OpNotEqual: {"OpNotEqual", []int{}},
 	OpGreaterThan: {"OpGreaterThan", []int{}},	// LessThan is missed, reorder the operands, decrease the instruction set
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},	// so is LessEqual
 
 	OpMinus: {"OpMinus", []int{}},
 	OpBang: {"OpBang", []int{}},
@@ -134,6 +170,22 @@ var definitions = map[Opcode]*Definition{
 
 	OpClosure: {"OpClosure", []int{2, 1}},
 	OpGetFree: {"OpGetFree", []int{1}},
+	OpSetFree: {"OpSetFree", []int{1}},
+	// push the cell of a variable instead of its value, to build a closure
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree: {"OpCaptureFree", []int{1}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpIter: {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2}},	// jump to the operand when the iterator is exhausted
+
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},	// the closure being executed, for recursion
+	OpTailCall: {"OpTailCall", []int{1}},	// OpCall reusing the frame of the caller, its result is returned right away
+
+	OpMod: {"OpMod", []int{}},
+	OpPow: {"OpPow", []int{}},
+
+	OpJumpNotNull: {"OpJumpNotNull", []int{2}},	// jump keeping a value that is not null, otherwise pop the null
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -55,6 +55,22 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestInstructionsStringInvalid(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{append(Make(OpAdd), 255, 0), "0000 OpAdd\n0001 ERROR: opcode 255 undefined.\n"},
+		{Make(OpConstant, 1)[:2], "0000 ERROR: operands of OpConstant truncated\n"},
+	}
+
+	for _, tt := range tests {
+		if tt.ins.String() != tt.expected {
+			t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", tt.expected, tt.ins.String())
+		}
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -77,7 +93,7 @@ func TestReadOperands(t *testing.T) {
 		// Make and convert instruction back.
 		operandsRead, n := ReadOperands(def, instruction[1:])
 		if n != tt.bytesRead {
-			t.Fatalf("n wrong. want=%q, got=%q", tt.bytesRead, n)
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
 		}
 
 		for i, want := range tt.operands {
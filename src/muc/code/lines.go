@@ -0,0 +1,24 @@
+package code
+
+import (
+	"muc/token"
+	"sort"
+)
+
+// The instructions from Offset up to the next entry were compiled from Pos
+type LineEntry struct {
+	Offset	int
+	Pos		token.Position
+}
+
+// Emitted by the compiler, sorted by Offset
+type LineTable []LineEntry
+
+// Source position of the instruction at `offset`, invalid if unknown
+func (lt LineTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(lt), func(i int) bool { return lt[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return lt[i-1].Pos
+}
@@ -2,10 +2,11 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
+	"strings"
 	"muc/ast"
 	"muc/code"
 	"muc/object"
+	"muc/token"
 )
 
 type EmittedInstruction struct {
@@ -17,6 +18,16 @@ type CompilationScope struct {
 	instructions 		code.Instructions
 	lastInstruction		EmittedInstruction
 	previousInstruction	EmittedInstruction
+
+	loops				[]*Loop		// enclosing loops, the innermost is the last
+	lines				code.LineTable
+	body				*ast.BlockStatement	// of the function, nil for the main program
+}
+
+// Jump targets of a loop, `break` jumps are back-patched when the loop ends
+type Loop struct {
+	continuePos	int
+	breaks		[]int
 }
 
 type Compiler struct {
@@ -30,11 +41,14 @@ type Compiler struct {
 
 	scopes	[]CompilationScope
 	scopeIndex int
+
+	position	token.Position	// of the node being compiled
 }
 
 type ByteCode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Lines		 code.LineTable
 }
 
 func New() *Compiler {
@@ -75,10 +89,37 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	updatedInstructions := append(c.currentInstructions(), ins...)
 
 	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.addLine(posNewInstruction)
 
 	return posNewInstruction
 }
 
+// Record the current source position for the instruction at `offset`
+func (c *Compiler) addLine(offset int) {
+	if !c.position.IsValid() {
+		return
+	}
+	lines := c.scopes[c.scopeIndex].lines
+	if n := len(lines); n > 0 {
+		if lines[n-1].Pos == c.position {
+			return
+		}
+		if lines[n-1].Offset == offset {
+			lines = lines[:n-1]
+		}
+	}
+	c.scopes[c.scopeIndex].lines = append(lines, code.LineEntry{Offset: offset, Pos: c.position})
+}
+
+// Drop the line entries of removed instructions
+func (c *Compiler) truncateLines(end int) {
+	lines := c.scopes[c.scopeIndex].lines
+	for len(lines) > 0 && lines[len(lines)-1].Offset >= end {
+		lines = lines[:len(lines)-1]
+	}
+	c.scopes[c.scopeIndex].lines = lines
+}
+
 func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 	previous := c.scopes[c.scopeIndex].lastInstruction
 	last := EmittedInstruction{Opcode: op, Position: pos}
@@ -104,6 +145,20 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.truncateLines(last.Position)
+}
+
+// A block used as a value leaves its last expression on the stack,
+// blocks ending with a statement (let, while...) leave null
+func (c *Compiler) keepBlockValue(block *ast.BlockStatement) {
+	n := len(block.Statements)
+	if n > 0 {
+		if _, ok := block.Statements[n-1].(*ast.ExpressionStatement); ok && c.lastInstructionIs(code.OpPop) {
+			c.removeLastPop()
+			return
+		}
+	}
+	c.emit(code.OpNull)
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
@@ -121,18 +176,102 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 	c.replaceInstruction(opPos, newInstruction)
 }
 
-func (c *Compiler) loadSymbol(s Symbol) {
+func (c *Compiler) loadSymbol(s Symbol) int {
 	switch s.Scope {
 	case GlobalScope:
-		c.emit(code.OpGetGlobal, s.Index)
+		return c.emit(code.OpGetGlobal, s.Index)
 	case LocalScope:
-		c.emit(code.OpGetLocal, s.Index)
+		return c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
-		c.emit(code.OpGetBuiltin, s.Index)
+		return c.emit(code.OpGetBuiltin, s.Index)
 	case FreeScope:
-		c.emit(code.OpGetFree, s.Index)
-		
+		return c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		return c.emit(code.OpCurrentClosure)
 	}
+	return -1
+}
+
+func (c *Compiler) storeSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	default:
+		return fmt.Errorf("cannot assign to %s %s", strings.ToLower(string(s.Scope)), s.Name)
+	}
+	return nil
+}
+
+// the free variables of a closure share the cells of the enclosing scope
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	case FunctionScope:
+		// the closure never changes, no cell is needed
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// A local function can refer to itself by OpCurrentClosure instead of
+// capturing its own variable, if the variable is never bound again
+func (c *Compiler) canReferToItself(name string) bool {
+	symbol, ok := c.symbolTable.store[name]
+	body := c.scopes[c.scopeIndex].body
+	if !ok || symbol.Scope != LocalScope || body == nil {
+		return false
+	}
+
+	lets := 0
+	rebound := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name.Value == name {
+				lets++
+			}
+		case *ast.ForStatement:
+			rebound = rebound || node.Variable.Value == name
+		case *ast.AssignExpression:
+			if ident, ok := node.Target.(*ast.Identifier); ok && ident.Value == name {
+				rebound = true
+			}
+		}
+		return !rebound
+	})
+	return !rebound && lets == 1
+}
+
+func (c *Compiler) enterLoop(continuePos int) *Loop {
+	loop := &Loop{continuePos: continuePos}
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, loop)
+	return loop
+}
+
+// patch the `break` jumps to the current position
+func (c *Compiler) leaveLoop(loop *Loop) {
+	afterLoopPos := len(c.currentInstructions())
+	for _, pos := range loop.breaks {
+		c.changeOperand(pos, afterLoopPos)
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+func (c *Compiler) currentLoop() *Loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
 }
 
 func (c *Compiler) enterScope() {
@@ -161,6 +300,12 @@ func (c *Compiler) leaveScope() code.Instructions {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	outer := c.position
+	if pos := node.Pos(); pos.IsValid() {
+		c.position = pos
+	}
+	defer func() { c.position = outer }()
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -174,20 +319,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		// The value is compiled first, so `let x = x + 1` reads the x already
+		// in scope. A function is defined first to refer to itself
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		var symbol Symbol
+		if isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
 		err := c.Compile(node.Value)
 		if err != nil { return err }
-
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
+		if !isFunction {
+			symbol = c.symbolTable.Define(node.Name.Value)
 		}
 
+		c.storeSymbol(symbol)
+
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return fmt.Errorf("%s: undefined variable %s", node.Pos(), node.Value)
 		}
 
 		c.loadSymbol(symbol)
@@ -205,15 +355,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 	
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
+		// in source order, which is the order of the hash
+		for _, k := range node.Keys {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -227,18 +370,54 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpHash, len(node.Pairs) * 2)
 	
-	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
-		if err != nil { return err }
+	case *ast.AssignExpression:
+		switch target := node.Target.(type) {
+		case *ast.Identifier:
+			symbol, ok := c.symbolTable.Resolve(target.Value)
+			if !ok {
+				return fmt.Errorf("%s: undefined variable %s", target.Pos(), target.Value)
+			}
+
+			err := c.Compile(node.Value)
+			if err != nil { return err }
+
+			err = c.storeSymbol(symbol)
+			if err != nil {
+				return fmt.Errorf("%s: %s", node.Pos(), err)
+			}
+			// the assignment is an expression, leave the value on the stack
+			c.loadSymbol(symbol)
+
+		case *ast.IndexExpression:
+			err := c.Compile(target.Left)
+			if err != nil { return err }
+			err = c.Compile(target.Index)
+			if err != nil { return err }
+			err = c.Compile(node.Value)
+			if err != nil { return err }
+
+			c.emit(code.OpSetIndex)
+
+		default:
+			return fmt.Errorf("%s: cannot assign to %s", node.Pos(), node.Target.String())
+		}
 
-		err = c.Compile(node.Index)
+	case *ast.IndexExpression:
+		nullJumps, err := c.compileIndexChain(node)
 		if err != nil { return err }
 
-		c.emit(code.OpIndex)
+		for _, pos := range nullJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
 
 	case *ast.FunctionLiteral:
+		selfReference := node.Name != "" && c.canReferToItself(node.Name)
 		c.enterScope()
+		c.scopes[c.scopeIndex].body = node.Body
 
+		if selfReference {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
 		for _, p := range node.Parameters {
 			c.symbolTable.Define(p.Value)
 		}
@@ -252,19 +431,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if !c.lastInstructionIs(code.OpReturnValue) {
 			c.emit(code.OpReturn)
 		}
+		c.markTailCalls()
 		
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		lines := c.scopes[c.scopeIndex].lines
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
-			c.loadSymbol(s)
+			c.captureSymbol(s)
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions: instructions,
 			NumLocals: numLocals,
 			NumParameters: len(node.Parameters),
+			Name: node.Name,
+			Lines: lines,
 		}
 		// c.emit(code.OpConstant, c.addConstant(compiledFn))
 		fnIndex := c.addConstant(compiledFn)
@@ -287,10 +470,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		err = c.Compile(node.Consequence)
 		if err != nil { return err }
-
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
+		c.keepBlockValue(node.Consequence)
 
 		jumpPos := c.emit(code.OpJump, 9999)
 		// Locate the position
@@ -303,10 +483,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		} else {
 			err := c.Compile(node.Alternative)
 			if err != nil { return err }
-
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
+			c.keepBlockValue(node.Alternative)
 		}
 
 		afterAlternativePos := len(c.currentInstructions())
@@ -325,6 +502,55 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil { return err }
 
 		c.emit(code.OpReturnValue)
+
+	case *ast.WhileStatement:
+		loopStartPos := len(c.currentInstructions())
+		err := c.Compile(node.Condition)
+		if err != nil { return err }
+		jumpNotTruthPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		loop := c.enterLoop(loopStartPos)
+		err = c.Compile(node.Body)
+		if err != nil { return err }
+		c.emit(code.OpJump, loopStartPos)
+
+		c.changeOperand(jumpNotTruthPos, len(c.currentInstructions()))
+		c.leaveLoop(loop)
+
+	case *ast.ForStatement:
+		err := c.Compile(node.Iterable)
+		if err != nil { return err }
+		c.emit(code.OpIter)
+
+		// the iterator lives in a hidden variable, so `break` leaves nothing on the stack
+		iterator := c.symbolTable.Define(fmt.Sprintf("$iter%d", len(c.scopes[c.scopeIndex].loops)))
+		c.storeSymbol(iterator)
+
+		loopStartPos := c.loadSymbol(iterator)
+		iterNextPos := c.emit(code.OpIterNext, 9999)
+		c.storeSymbol(c.symbolTable.Define(node.Variable.Value))
+
+		loop := c.enterLoop(loopStartPos)
+		err = c.Compile(node.Body)
+		if err != nil { return err }
+		c.emit(code.OpJump, loopStartPos)
+
+		c.changeOperand(iterNextPos, len(c.currentInstructions()))
+		c.leaveLoop(loop)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: break outside of a loop", node.Pos())
+		}
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("%s: continue outside of a loop", node.Pos())
+		}
+		c.emit(code.OpJump, loop.continuePos)
 	
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
@@ -336,20 +562,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case "-":
 			c.emit(code.OpMinus)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
 		}
 
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
+		if node.Operator == "<" || node.Operator == "<=" {
 			// First push the right operand
 			err := c.Compile(node.Right)
 			if err != nil { return err }
 
 			err = c.Compile(node.Left)
 			if err != nil { return err }
-			c.emit(code.OpGreaterThan)
+			if node.Operator == "<" {
+				c.emit(code.OpGreaterThan)
+			} else {
+				c.emit(code.OpGreaterEqual)
+			}
 			return nil
 		}
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		if node.Operator == "??" {
+			return c.compileNullish(node)
+		}
 
 		err := c.Compile(node.Left)
 		if err != nil { return err }
@@ -365,14 +601,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
 		case ">":
 			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
 		}
 
 	case *ast.IntegerLiteral:
@@ -380,6 +622,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 		// the operands of constant is its position in constant pool
 		c.emit(code.OpConstant, c.addConstant(integer))
 
+	case *ast.BigIntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.BigInt{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
@@ -391,10 +643,90 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// The right operand is skipped once the left one decides the result:
+//   a && b  =>  if (a) { !!b } else { false }
+//   a || b  =>  if (a) { true } else { !!b }
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil { return err }
+	jumpNotTruthPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+	} else {
+		err = c.compileBoolean(node.Right)
+		if err != nil { return err }
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthPos, len(c.currentInstructions()))
+
+	if node.Operator == "||" {
+		err = c.compileBoolean(node.Right)
+		if err != nil { return err }
+	} else {
+		c.emit(code.OpFalse)
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// The right operand is only evaluated if the left one is null:
+//   a ?? b  =>  a, OpJumpNotNull end, b, end:
+func (c *Compiler) compileNullish(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil { return err }
+	jumpNotNullPos := c.emit(code.OpJumpNotNull, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil { return err }
+	c.changeOperand(jumpNotNullPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// A null before `?[` skips the rest of the chain, so a?[0][1] is null too.
+// The jumps to the end of the chain are returned for the caller to patch:
+//   a?[k]  =>  a, OpJumpNotNull index, OpNull, OpJump end, index: k, OpIndex, end:
+func (c *Compiler) compileIndexChain(node *ast.IndexExpression) ([]int, error) {
+	var nullJumps []int
+	var err error
+	if inner, ok := node.Left.(*ast.IndexExpression); ok {
+		nullJumps, err = c.compileIndexChain(inner)
+	} else {
+		err = c.Compile(node.Left)
+	}
+	if err != nil { return nil, err }
+
+	if node.Safe {
+		jumpNotNullPos := c.emit(code.OpJumpNotNull, 9999)
+		c.emit(code.OpNull)
+		nullJumps = append(nullJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(jumpNotNullPos, len(c.currentInstructions()))
+	}
+
+	err = c.Compile(node.Index)
+	if err != nil { return nil, err }
+	c.emit(code.OpIndex)
+
+	return nullJumps, nil
+}
+
+// convert the value of an expression to true or false
+func (c *Compiler) compileBoolean(node ast.Expression) error {
+	err := c.Compile(node)
+	if err != nil { return err }
+
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
 func (c *Compiler) Bytecode() *ByteCode {
 	return &ByteCode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		Lines:		  c.scopes[c.scopeIndex].lines,
 	}
 }
 
@@ -413,6 +745,39 @@ func (c *Compiler) addConstant(obj object.Object) int {
 	return len(c.constants) - 1
 }
 
+// A call whose result is returned right away, maybe through the jumps
+// out of an if-expression, is turned into OpTailCall
+func (c *Compiler) markTailCalls() {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(ins); {
+		_, _, width, _ := ins.Decode(i)
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, i + width) {
+			ins[i] = byte(code.OpTailCall)
+		}
+		i += width
+	}
+}
+
+func returnsAt(ins code.Instructions, pos int) bool {
+	for pos < len(ins) {
+		switch code.Opcode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			target := int(code.ReadUint16(ins[pos+1:]))
+			// loops jump backwards
+			if target <= pos {
+				return false
+			}
+			pos = target
+		default:
+			return false
+		}
+	}
+	return false
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
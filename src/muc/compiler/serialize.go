@@ -0,0 +1,311 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"muc/code"
+	"muc/object"
+	"muc/token"
+)
+
+/**
+Bytecode file layout, all numbers are big endian:
+
+	magic        "MUB\x00"
+	version      uint16
+	instructions uint32 length, bytes
+	lines        uint32 count, each is the offset, line and column as uint32 and the file
+	constants    uint32 count, each is a tag byte followed by its payload
+
+Strings and byte slices are prefixed by their uint32 length.
+*/
+var Magic = []byte("MUB\x00")
+
+// Increase it whenever the layout or the instruction set changes
+const FormatVersion uint16 = 7
+
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagCompiledFunction
+	tagBigInt
+)
+
+func (b *ByteCode) Serialize() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.Write(Magic)
+	writeUint16(&out, FormatVersion)
+	writeBytes(&out, b.Instructions)
+	writeLines(&out, b.Lines)
+
+	writeUint32(&out, uint32(len(b.Constants)))
+	for i, constant := range b.Constants {
+		err := writeConstant(&out, constant)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %s", i, err)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func Deserialize(data []byte) (*ByteCode, error) {
+	r := bytes.NewReader(data)
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, Magic) {
+		return nil, fmt.Errorf("not a bytecode file")
+	}
+
+	version, err := readUint16(r)
+	if err != nil {
+		return nil, err
+	}
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want=%d", version, FormatVersion)
+	}
+
+	instructions, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	// every constant takes at least one byte, a larger count is corrupt
+	if int64(count) > int64(r.Len()) {
+		return nil, errTruncated
+	}
+	constants := make([]object.Object, 0, count)
+	for i := uint32(0); i < count; i++ {
+		constant, err := readConstant(r)
+		if err != nil {
+			return nil, fmt.Errorf("constant %d: %s", i, err)
+		}
+		constants = append(constants, constant)
+	}
+
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("unexpected %d trailing bytes", r.Len())
+	}
+
+	bytecode := &ByteCode{Instructions: instructions, Constants: constants, Lines: lines}
+	if err := bytecode.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %s", err)
+	}
+	return bytecode, nil
+}
+
+func writeConstant(out *bytes.Buffer, constant object.Object) error {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		out.WriteByte(tagInteger)
+		writeUint64(out, uint64(constant.Value))
+	case *object.BigInt:
+		out.WriteByte(tagBigInt)
+		writeBytes(out, []byte(constant.Value.String()))
+	case *object.Float:
+		out.WriteByte(tagFloat)
+		writeUint64(out, math.Float64bits(constant.Value))
+	case *object.String:
+		out.WriteByte(tagString)
+		writeBytes(out, []byte(constant.Value))
+	case *object.CompiledFunction:
+		out.WriteByte(tagCompiledFunction)
+		writeUint32(out, uint32(constant.NumLocals))
+		writeUint32(out, uint32(constant.NumParameters))
+		writeBytes(out, constant.Instructions)
+		writeBytes(out, []byte(constant.Name))
+		writeLines(out, constant.Lines)
+	default:
+		return fmt.Errorf("cannot serialize %s", constant.Type())
+	}
+	return nil
+}
+
+func readConstant(r *bytes.Reader) (object.Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, errTruncated
+	}
+
+	switch tag {
+	case tagInteger:
+		value, err := readUint64(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Integer{Value: int64(value)}, nil
+	case tagBigInt:
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		integer, ok := new(big.Int).SetString(string(value), 10)
+		if !ok {
+			return nil, fmt.Errorf("malformed integer %q", value)
+		}
+		return &object.BigInt{Value: integer}, nil
+	case tagFloat:
+		value, err := readUint64(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.Float{Value: math.Float64frombits(value)}, nil
+	case tagString:
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.String{Value: string(value)}, nil
+	case tagCompiledFunction:
+		numLocals, err := readUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		numParameters, err := readUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		instructions, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := readLines(r)
+		if err != nil {
+			return nil, err
+		}
+		return &object.CompiledFunction{
+			Instructions: code.Instructions(instructions),
+			NumLocals: int(numLocals),
+			NumParameters: int(numParameters),
+			Name: string(name),
+			Lines: lines,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown constant tag %d", tag)
+}
+
+func writeLines(out *bytes.Buffer, lines code.LineTable) {
+	writeUint32(out, uint32(len(lines)))
+	for _, entry := range lines {
+		writeUint32(out, uint32(entry.Offset))
+		writeUint32(out, uint32(entry.Pos.Line))
+		writeUint32(out, uint32(entry.Pos.Column))
+		writeBytes(out, []byte(entry.Pos.File))
+	}
+}
+
+func readLines(r *bytes.Reader) (code.LineTable, error) {
+	count, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	// an entry takes at least 16 bytes
+	if int64(count) * 16 > int64(r.Len()) {
+		return nil, errTruncated
+	}
+
+	var lines code.LineTable
+	for i := uint32(0); i < count; i++ {
+		var fields [3]uint32
+		for j := range fields {
+			fields[j], err = readUint32(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		file, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, code.LineEntry{
+			Offset: int(fields[0]),
+			Pos: token.Position{File: string(file), Line: int(fields[1]), Column: int(fields[2])},
+		})
+	}
+	return lines, nil
+}
+
+var errTruncated = fmt.Errorf("unexpected end of bytecode file")
+
+func writeUint16(out *bytes.Buffer, v uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	out.Write(buf[:])
+}
+
+func writeUint32(out *bytes.Buffer, v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	out.Write(buf[:])
+}
+
+func writeUint64(out *bytes.Buffer, v uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	out.Write(buf[:])
+}
+
+// length prefixed
+func writeBytes(out *bytes.Buffer, b []byte) {
+	writeUint32(out, uint32(len(b)))
+	out.Write(b)
+}
+
+func readUint16(r *bytes.Reader) (uint16, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, errTruncated
+	}
+	return binary.BigEndian.Uint16(buf[:]), nil
+}
+
+func readUint32(r *bytes.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, errTruncated
+	}
+	return binary.BigEndian.Uint32(buf[:]), nil
+}
+
+func readUint64(r *bytes.Reader) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, errTruncated
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > int64(r.Len()) {
+		return nil, errTruncated
+	}
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return b, nil
+}
@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"muc/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSerializeRoundTrip(t *testing.T) {
+	input := `
+	let greet = fn(name) { let prefix = "hello "; prefix + name };
+	let scale = fn(x) { fn(y) { x * y * 2.5 } };
+	greet("mua");
+	scale(-3)(4);
+	99999999999999999999 - 1;
+	`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	data, err := bytecode.Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+	decoded, err := Deserialize(data)
+	if err != nil {
+		t.Fatalf("deserialize error: %s", err)
+	}
+
+	if !reflect.DeepEqual(bytecode, decoded) {
+		t.Fatalf("bytecode changed after round trip.\nwant=%#v\ngot=%#v", bytecode, decoded)
+	}
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	valid, err := (&ByteCode{
+		Instructions: nil,
+		Constants: []object.Object{&object.String{Value: "mua"}},
+	}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+	badVersion := append([]byte{}, valid...)
+	badVersion[len(Magic)] = 0xff
+	empty, _ := (&ByteCode{}).Serialize()
+	hugeConstants := append([]byte{}, empty...)
+	copy(hugeConstants[len(hugeConstants)-4:], []byte{0xff, 0xff, 0xff, 0xff})
+	hugeLines := append([]byte{}, empty...)
+	copy(hugeLines[len(hugeLines)-8:], []byte{0xff, 0xff, 0xff, 0xff})
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a bytecode file"},
+		{badVersion, "unsupported bytecode version"},
+		{valid[:len(valid)-1], "constant 0: unexpected end of bytecode file"},
+		{append(append([]byte{}, valid...), 0), "unexpected 1 trailing bytes"},
+		{hugeConstants, "unexpected end of bytecode file"},
+		{hugeLines, "unexpected end of bytecode file"},
+	}
+
+	for _, tt := range tests {
+		_, err := Deserialize(tt.data)
+		if err == nil {
+			t.Fatalf("expected error %q but resulted in none.", tt.expected)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	_, err = (&ByteCode{Constants: []object.Object{&object.Boolean{Value: true}}}).Serialize()
+	if err == nil || err.Error() != "constant 0: cannot serialize BOOLEAN" {
+		t.Errorf("wrong serialize error. got=%v", err)
+	}
+}
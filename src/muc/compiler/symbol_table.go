@@ -7,6 +7,7 @@ const (
 	LocalScope  SymbolScope = "LOCAL"
 	BuiltinScope SymbolScope = "BUILTIN"
 	FreeScope   SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
 )
 
 type Symbol struct {
@@ -37,6 +38,12 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 }
 
 func (s *SymbolTable) Define(name string) Symbol {
+	// `let x = x + 1` in the same scope reuses the slot of x
+	if existing, ok := s.store[name]; ok &&
+		(existing.Scope == GlobalScope || existing.Scope == LocalScope) {
+		return existing
+	}
+
 	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
@@ -72,6 +79,14 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
+// The name of the function being compiled, it resolves to the closure itself.
+// Define it before the parameters, so they can shadow it
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
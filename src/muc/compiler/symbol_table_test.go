@@ -292,4 +292,56 @@ func TestResolveUnresolvableFree(t *testing.T) {
 			t.Errorf("name %s resolved, but was expected not to", name)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestRedefineInSameScope(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	a := global.Define("a")
+	global.Define("b")
+	if again := global.Define("a"); again != a {
+		t.Errorf("expected a=%+v, got=%+v", a, again)
+	}
+
+	expected := Symbol{Name: "len", Scope: GlobalScope, Index: 2}
+	if shadow := global.Define("len"); shadow != expected {
+		t.Errorf("expected len=%+v, got=%+v", expected, shadow)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.Resolve("a")
+	expected = Symbol{Name: "a", Scope: LocalScope, Index: 0}
+	if shadow := local.Define("a"); shadow != expected {
+		t.Errorf("expected a=%+v, got=%+v", expected, shadow)
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+
+	expected := Symbol{Name: "f", Scope: FunctionScope, Index: 0}
+	if result, ok := local.Resolve("f"); !ok || result != expected {
+		t.Errorf("expected f to resolve to %+v, got=%+v", expected, result)
+	}
+
+	// a parameter with the same name shadows the function name
+	expected = Symbol{Name: "f", Scope: LocalScope, Index: 0}
+	if shadow := local.Define("f"); shadow != expected {
+		t.Errorf("expected f=%+v, got=%+v", expected, shadow)
+	}
+
+	// an inner function captures the function name as a free variable
+	inner := NewEnclosedSymbolTable(NewEnclosedSymbolTable(global))
+	inner.Outer.DefineFunctionName("g")
+	expected = Symbol{Name: "g", Scope: FreeScope, Index: 0}
+	if result, ok := inner.Resolve("g"); !ok || result != expected {
+		t.Errorf("expected g to resolve to %+v, got=%+v", expected, result)
+	}
+	if len(inner.FreeSymbols) != 1 || inner.FreeSymbols[0].Scope != FunctionScope {
+		t.Errorf("wrong free symbols. got=%+v", inner.FreeSymbols)
+	}
+}
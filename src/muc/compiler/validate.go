@@ -0,0 +1,121 @@
+package compiler
+
+import (
+	"fmt"
+	"muc/code"
+	"muc/object"
+)
+
+/**
+Check bytecode that was not compiled in this process, like a loaded file, so
+the VM can run it without indexing out of range. Every instruction must decode,
+jumps must land on an instruction, and constants, builtins, locals and free
+variables must exist. Errors name the function and offset:
+
+	fn 2: 0004: OpGetLocal refers to missing local 3
+*/
+func (b *ByteCode) Validate() error {
+	v := &validator{constants: b.Constants, numFree: map[int]int{}}
+
+	// decode everything first, the free variables of a function are counted
+	// by the OpClosure that builds it
+	main, err := v.decode(b.Instructions)
+	if err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+	functions := map[int]map[int]bool{}
+	for i, constant := range b.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			starts, err := v.decode(fn.Instructions)
+			if err != nil {
+				return fmt.Errorf("fn %d: %s", i, err)
+			}
+			functions[i] = starts
+		}
+	}
+
+	// main has no locals and no free variables, its variables are globals
+	if err := v.check(b.Instructions, main, 0, 0); err != nil {
+		return fmt.Errorf("main: %s", err)
+	}
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.NumParameters > fn.NumLocals {
+			return fmt.Errorf("fn %d: %d parameters but %d locals", i, fn.NumParameters, fn.NumLocals)
+		}
+		if err := v.check(fn.Instructions, functions[i], fn.NumLocals, v.numFree[i]); err != nil {
+			return fmt.Errorf("fn %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+type validator struct {
+	constants	[]object.Object
+	numFree		map[int]int	// by the constant index of a function
+}
+
+// The offsets where instructions start, and the free variable counts of OpClosure
+func (v *validator) decode(ins code.Instructions) (map[int]bool, error) {
+	starts := map[int]bool{}
+	for i := 0; i < len(ins); {
+		_, operands, width, err := ins.Decode(i)
+		if err != nil {
+			return nil, fmt.Errorf("%04d: %s", i, err)
+		}
+		if code.Opcode(ins[i]) == code.OpClosure {
+			if numFree, ok := v.numFree[operands[0]]; ok && numFree != operands[1] {
+				return nil, fmt.Errorf("%04d: OpClosure builds fn %d with %d free variables, elsewhere %d",
+					i, operands[0], operands[1], numFree)
+			}
+			v.numFree[operands[0]] = operands[1]
+		}
+		starts[i] = true
+		i += width
+	}
+	return starts, nil
+}
+
+func (v *validator) check(ins code.Instructions, starts map[int]bool, numLocals, numFree int) error {
+	for i := 0; i < len(ins); {
+		def, operands, width, _ := ins.Decode(i)
+		if err := v.checkOperands(code.Opcode(ins[i]), operands, starts, len(ins), numLocals, numFree); err != nil {
+			return fmt.Errorf("%04d: %s %s", i, def.Name, err)
+		}
+		i += width
+	}
+	return nil
+}
+
+func (v *validator) checkOperands(op code.Opcode, operands []int, starts map[int]bool, end, numLocals, numFree int) error {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotNull, code.OpIterNext:
+		if target := operands[0]; !starts[target] && target != end {
+			return fmt.Errorf("jumps to invalid target %d", target)
+		}
+	case code.OpConstant, code.OpClosure:
+		index := operands[0]
+		if index >= len(v.constants) {
+			return fmt.Errorf("refers to missing constant %d", index)
+		}
+		if _, ok := v.constants[index].(*object.CompiledFunction); op == code.OpClosure && !ok {
+			return fmt.Errorf("constant %d is not a function", index)
+		}
+	case code.OpGetBuiltin:
+		if index := operands[0]; index >= len(object.Builtins) {
+			return fmt.Errorf("refers to missing builtin %d", index)
+		}
+	case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+		if index := operands[0]; index >= numLocals {
+			return fmt.Errorf("refers to missing local %d", index)
+		}
+	case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+		if index := operands[0]; index >= numFree {
+			return fmt.Errorf("refers to missing free variable %d", index)
+		}
+	}
+	return nil
+}
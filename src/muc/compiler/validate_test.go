@@ -0,0 +1,93 @@
+package compiler
+
+import (
+	"muc/code"
+	"muc/object"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	input := `
+	let counter = fn() { let n = 0; fn() { n = n + 1; n } };
+	let sum = fn(arr) { let s = 0; for (x in arr) { s = s + x; } s };
+	let f = fn(n) { if (n > 0) { f(n - 1) } else { len([n]) } };
+	counter()();
+	sum([1, 2]) ?? f(3);
+	`
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if err := compiler.Bytecode().Validate(); err != nil {
+		t.Fatalf("compiled bytecode is invalid: %s", err)
+	}
+
+	function := func(numLocals int, ins ...code.Instructions) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: concatInstructions(ins), NumLocals: numLocals}
+	}
+	tests := []struct {
+		bytecode *ByteCode
+		expected string
+	}{
+		{
+			&ByteCode{Instructions: code.Make(code.OpClosure, 32767, 0)},
+			"main: 0000: OpClosure refers to missing constant 32767",
+		},
+		{
+			&ByteCode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"main: 0000: OpGetLocal refers to missing local 0",
+		},
+		{
+			&ByteCode{Constants: []object.Object{function(1, code.Make(code.OpSetLocal, 1))}},
+			"fn 0: 0000: OpSetLocal refers to missing local 1",
+		},
+		{
+			&ByteCode{
+				Instructions: code.Make(code.OpClosure, 0, 1),
+				Constants: []object.Object{function(0, code.Make(code.OpGetFree, 1))},
+			},
+			"fn 0: 0000: OpGetFree refers to missing free variable 1",
+		},
+		{
+			&ByteCode{
+				Instructions: concatInstructions([]code.Instructions{code.Make(code.OpClosure, 0, 1), code.Make(code.OpClosure, 0, 2)}),
+				Constants: []object.Object{function(0)},
+			},
+			"main: 0004: OpClosure builds fn 0 with 2 free variables, elsewhere 1",
+		},
+		{
+			&ByteCode{Constants: []object.Object{&object.CompiledFunction{NumParameters: 2, NumLocals: 1}}},
+			"fn 0: 2 parameters but 1 locals",
+		},
+		{
+			&ByteCode{Instructions: code.Make(code.OpJumpNotNull, 2)},
+			"main: 0000: OpJumpNotNull jumps to invalid target 2",
+		},
+		{
+			&ByteCode{Instructions: code.Make(code.OpGetBuiltin, 255)},
+			"main: 0000: OpGetBuiltin refers to missing builtin 255",
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.bytecode.Validate()
+		if err == nil {
+			t.Fatalf("expected error %q but resulted in none.", tt.expected)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDeserializeValidates(t *testing.T) {
+	data, err := (&ByteCode{Instructions: code.Make(code.OpClosure, 32767, 0)}).Serialize()
+	if err != nil {
+		t.Fatalf("serialize error: %s", err)
+	}
+	_, err = Deserialize(data)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid bytecode: main: 0000: OpClosure") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"muc/code"
+	"muc/compiler"
+	"muc/object"
+	"strconv"
+)
+
+/**
+Print the main program, the constant pool, and every compiled function of the pool.
+The bytecode is validated first, jump targets and constant operands are shown inline:
+
+	== main ==
+	0000 OpConstant 0		; 10
+	0003 OpJumpNotTruthy 9	; -> 0009
+*/
+func Disassemble(w io.Writer, bytecode *compiler.ByteCode) error {
+	if err := bytecode.Validate(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "== main ==")
+	listing(w, bytecode.Instructions, bytecode.Constants)
+
+	fmt.Fprintln(w, "== constants ==")
+	for i, constant := range bytecode.Constants {
+		fmt.Fprintf(w, "%04d %s %s\n", i, constant.Type(), describe(i, constant))
+	}
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		name := ""
+		if fn.Name != "" {
+			name = " " + fn.Name
+		}
+		fmt.Fprintf(w, "== fn %d%s (locals: %d, parameters: %d) ==\n", i, name, fn.NumLocals, fn.NumParameters)
+		listing(w, fn.Instructions, bytecode.Constants)
+	}
+	return nil
+}
+
+func listing(w io.Writer, ins code.Instructions, constants []object.Object) {
+	for i := 0; i < len(ins); {
+		def, operands, width, _ := ins.Decode(i)
+		text := fmt.Sprintf("%04d %s", i, def.Name)
+		for _, operand := range operands {
+			text += fmt.Sprintf(" %d", operand)
+		}
+		if comment := annotate(code.Opcode(ins[i]), operands, constants); comment != "" {
+			text += "\t; " + comment
+		}
+		fmt.Fprintln(w, text)
+		i += width
+	}
+}
+
+func annotate(op code.Opcode, operands []int, constants []object.Object) string {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotNull, code.OpIterNext:
+		return fmt.Sprintf("-> %04d", operands[0])
+	case code.OpConstant, code.OpClosure:
+		return describe(operands[0], constants[operands[0]])
+	case code.OpGetBuiltin:
+		return object.Builtins[operands[0]].Name
+	}
+	return ""
+}
+
+func describe(index int, constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.String:
+		return strconv.Quote(constant.Value)
+	case *object.CompiledFunction:
+		return fmt.Sprintf("fn %d", index)
+	}
+	return constant.Inspect()
+}
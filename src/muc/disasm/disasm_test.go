@@ -0,0 +1,103 @@
+package disasm
+
+import (
+	"bytes"
+	"muc/code"
+	"muc/compiler"
+	"muc/lexer"
+	"muc/object"
+	"muc/parser"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *compiler.ByteCode {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func TestDisassemble(t *testing.T) {
+	input := `
+	let add = fn(a, b) { if (a > 1.5) { a + b } else { "small" } };
+	puts(add(1, 2));
+	`
+	expected := `== main ==
+0000 OpClosure 2 0	; fn 2
+0004 OpSetGlobal 0
+0007 OpGetBuiltin 1	; puts
+0009 OpGetGlobal 0
+0012 OpConstant 3	; 1
+0015 OpConstant 4	; 2
+0018 OpCall 2
+0020 OpCall 1
+0022 OpPop
+== constants ==
+0000 FLOAT 1.5
+0001 STRING "small"
+0002 COMPILED_FUNCTION_OBJ fn 2
+0003 INTEGER 1
+0004 INTEGER 2
+== fn 2 add (locals: 2, parameters: 2) ==
+0000 OpGetLocal 0
+0002 OpConstant 0	; 1.5
+0005 OpGreaterThan
+0006 OpJumpNotTruthy 17	; -> 0017
+0009 OpGetLocal 0
+0011 OpGetLocal 1
+0013 OpAdd
+0014 OpJump 20	; -> 0020
+0017 OpConstant 1	; "small"
+0020 OpReturnValue
+`
+	var out bytes.Buffer
+	if err := Disassemble(&out, compile(t, input)); err != nil {
+		t.Fatalf("disassemble error: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestDisassembleErrors(t *testing.T) {
+	tests := []struct {
+		bytecode *compiler.ByteCode
+		expected string
+	}{
+		{
+			&compiler.ByteCode{Instructions: code.Instructions{255}},
+			"main: 0000: opcode 255 undefined.",
+		},
+		{
+			&compiler.ByteCode{Instructions: code.Make(code.OpJump, 1)},
+			"main: 0000: OpJump jumps to invalid target 1",
+		},
+		{
+			&compiler.ByteCode{Instructions: code.Make(code.OpConstant, 3)},
+			"main: 0000: OpConstant refers to missing constant 3",
+		},
+		{
+			&compiler.ByteCode{Constants: []object.Object{
+				&object.CompiledFunction{Instructions: code.Make(code.OpConstant, 1)[:2]},
+			}},
+			"fn 0: 0000: operands of OpConstant truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Disassemble(&bytes.Buffer{}, tt.bytecode)
+		if err == nil {
+			t.Fatalf("expected error %q but resulted in none.", tt.expected)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
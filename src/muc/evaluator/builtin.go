@@ -6,21 +6,12 @@ import (
 
 /**
 * Registe BUILT-IN FUNCTIONs
-* 	- len
-* 	- first
-* 	- last
-*	- rest
-*	- push
-*	- pop
-*	- map
-*	- reduce
-*
-*   - puts
+*	- the library of object.Builtins, shared with the VM
 */
-var builtins = map[string]*object.Builtin {
-	"len": object.GetBuiltinByName("len"),
-	"puts": object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	// "first": &object.Builtin{Fn: _first},
-	// "print": &object.Builtin{Fn: _print},
-}
\ No newline at end of file
+var builtins = map[string]*object.Builtin {}
+
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
+	}
+}
@@ -39,6 +39,18 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 			Literal: fmt.Sprintf("%d", obj.Value),
 		}
 		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.BigInt:
+		t := token.Token {
+			Type:    token.BIGINT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.BigIntegerLiteral{Token: t, Value: obj.Value}
+	case *object.Float:
+		t := token.Token {
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
 	case *object.Boolean:
 		var t token.Token
 		if obj.Value {
@@ -47,6 +59,8 @@ func convertObjectToASTNode(obj object.Object) ast.Node {
 			t = token.Token{Type: token.FALSE, Literal: "false"}
 		}
 		return &ast.Boolean{Token: t, Value:  obj.Value}
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null"}}
 	case *object.Quote:
 		return obj.Node
 	}
@@ -0,0 +1,101 @@
+package interp
+
+import (
+	"fmt"
+	"math/big"
+	"muc/object"
+	"muc/vm"
+	"sort"
+)
+
+// Convert a Go value to a script value. Objects are returned as they are,
+// the pairs of a map are ordered by key
+func ToObject(value interface{}) (object.Object, error) {
+	switch value := value.(type) {
+	case nil:
+		return vm.Null, nil
+	case object.Object:
+		return value, nil
+	case bool:
+		if value {
+			return vm.True, nil
+		}
+		return vm.False, nil
+	case int:
+		return &object.Integer{Value: int64(value)}, nil
+	case int64:
+		return &object.Integer{Value: value}, nil
+	case *big.Int:
+		return object.NewInteger(new(big.Int).Set(value)), nil
+	case float64:
+		return &object.Float{Value: value}, nil
+	case string:
+		return &object.String{Value: value}, nil
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, v := range value {
+			element, err := ToObject(v)
+			if err != nil { return nil, err }
+			elements[i] = element
+		}
+		return &object.Array{Elements: elements}, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		hash := &object.Hash{}
+		for _, k := range keys {
+			val, err := ToObject(value[k])
+			if err != nil { return nil, err }
+			hash.Set(&object.String{Value: k}, val)
+		}
+		return hash, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %T to an object", value)
+	}
+}
+
+// Convert a script value to a Go value: null is nil, integers are int64
+// or *big.Int out of the int64 range, arrays are []interface{} and hashes
+// with string keys are map[string]interface{}
+func FromObject(obj object.Object) (interface{}, error) {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInt:
+		return new(big.Int).Set(obj.Value), nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := FromObject(element)
+			if err != nil { return nil, err }
+			values[i] = value
+		}
+		return values, nil
+	case *object.Hash:
+		values := make(map[string]interface{}, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert hash key of type %s", pair.Key.Type())
+			}
+			value, err := FromObject(pair.Value)
+			if err != nil { return nil, err }
+			values[key.Value] = value
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
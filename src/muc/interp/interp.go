@@ -0,0 +1,172 @@
+package interp
+
+import (
+	"context"
+	"fmt"
+	"muc/ast"
+	"muc/compiler"
+	"muc/lexer"
+	"muc/object"
+	"muc/parser"
+	"muc/runner"
+	"muc/vm"
+)
+
+// An Interpreter keeps the globals between runs like the REPL does, so
+// scripts, host functions and Go code share the same global names
+type Interpreter struct {
+	symbolTable *compiler.SymbolTable
+	constants	[]object.Object
+	globals		[]object.Object
+	limits		vm.Limits
+}
+
+func New() *Interpreter {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	return &Interpreter{
+		symbolTable: symbolTable,
+		constants: []object.Object{},
+		globals: []object.Object{},
+		limits: vm.DefaultLimits,
+	}
+}
+
+// Limits of every following Run and Call
+func (in *Interpreter) SetLimits(limits vm.Limits) {
+	in.limits = limits
+}
+
+// Define the global `name` as a function implemented in Go. Returning an
+// *object.Error stops the script with a runtime error
+func (in *Interpreter) Register(name string, fn object.BuiltinFunction) {
+	in.setGlobal(name, &object.Builtin{Fn: fn})
+}
+
+// Like Register, with arguments and results converted by FromObject and ToObject
+func (in *Interpreter) RegisterFunc(name string, fn func(args ...interface{}) (interface{}, error)) {
+	in.Register(name, func(args ...object.Object) object.Object {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			value, err := FromObject(arg)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s: argument %d: %s", name, i, err)}
+			}
+			values[i] = value
+		}
+
+		result, err := fn(values...)
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		obj, err := ToObject(result)
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		return obj
+	})
+}
+
+// Define or overwrite the global `name`, the value is converted by ToObject
+func (in *Interpreter) Set(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil { return err }
+
+	in.setGlobal(name, obj)
+	return nil
+}
+
+// The value of the global `name`, if the name is defined and was set
+func (in *Interpreter) Get(name string) (object.Object, bool) {
+	symbol, ok := in.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || symbol.Index >= len(in.globals) {
+		return nil, false
+	}
+	obj := in.globals[symbol.Index]
+	return obj, obj != nil
+}
+
+// An existing global keeps its slot, so compiled code reading it sees the new value
+func (in *Interpreter) setGlobal(name string, obj object.Object) {
+	symbol, ok := in.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = in.symbolTable.Define(name)
+	}
+	for len(in.globals) <= symbol.Index {
+		in.globals = append(in.globals, nil)
+	}
+	in.globals[symbol.Index] = obj
+}
+
+func (in *Interpreter) Run(input string) (object.Object, error) {
+	return in.RunContext(context.Background(), input)
+}
+
+// Compile and execute a script, the result is the value of its last
+// expression statement. Runtime errors are *vm.RuntimeError
+func (in *Interpreter) RunContext(ctx context.Context, input string) (object.Object, error) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &runner.ParseError{Errors: p.Errors()}
+	}
+
+	comp := compiler.NewWithState(in.symbolTable, in.constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compile error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	in.constants = bytecode.Constants
+
+	machine := vm.NewWithGlobalsState(bytecode, in.globals)
+	machine.SetLimits(in.limits)
+	err := machine.RunContext(ctx)
+	in.globals = machine.Globals()
+	if err != nil {
+		return nil, err
+	}
+
+	result := machine.LastPoppedStackElem()
+	if result == nil || !endsWithExpression(program) {
+		return vm.Null, nil
+	}
+	return result, nil
+}
+
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func (in *Interpreter) Call(name string, args ...interface{}) (object.Object, error) {
+	return in.CallContext(context.Background(), name, args...)
+}
+
+// Call the script or host function stored in the global `name`, the
+// arguments are converted by ToObject
+func (in *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (object.Object, error) {
+	fn, ok := in.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined function: %s", name)
+	}
+
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil { return nil, err }
+		objs[i] = obj
+	}
+
+	bytecode := &compiler.ByteCode{Constants: in.constants}
+	machine := vm.NewWithGlobalsState(bytecode, in.globals)
+	machine.SetLimits(in.limits)
+	result, err := machine.CallContext(ctx, fn, objs...)
+	in.globals = machine.Globals()
+	return result, err
+}
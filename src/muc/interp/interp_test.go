@@ -0,0 +1,261 @@
+package interp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"muc/object"
+	"muc/vm"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunKeepsGlobals(t *testing.T) {
+	in := New()
+	if _, err := in.Run("let x = 5; let add = fn(a, b) { a + b };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	result, err := in.Run("add(x, 10)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(15))
+
+	result, err = in.Run("let y = 1;")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if result != vm.Null {
+		t.Errorf("result is not Null. got=%T (%+v)", result, result)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	in := New()
+	values := map[string]interface{}{
+		"i": int64(3),
+		"g": new(big.Int).Lsh(big.NewInt(1), 70),
+		"f": 1.5,
+		"s": "mua",
+		"b": true,
+		"n": nil,
+		"a": []interface{}{int64(1), "two", []interface{}{3.0}},
+		"h": map[string]interface{}{"one": int64(1), "list": []interface{}{false}},
+	}
+	for name, value := range values {
+		if err := in.Set(name, value); err != nil {
+			t.Fatalf("Set(%q) failed: %s", name, err)
+		}
+	}
+	for name, value := range values {
+		obj, ok := in.Get(name)
+		if !ok {
+			t.Fatalf("global %q not found", name)
+		}
+		testValue(t, obj, value)
+	}
+
+	result, err := in.Run(`s + " " + h["list"][0] + a[1]`)
+	if err == nil {
+		t.Fatalf("expected error but got %s", result.Inspect())
+	}
+	result, err = in.Run(`len(a) + h["one"] + i`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(7))
+
+	if _, ok := in.Get("undefined"); ok {
+		t.Errorf("undefined global was found")
+	}
+	if _, ok := in.Get("len"); ok {
+		t.Errorf("builtin was returned as a global")
+	}
+	if err := in.Set("c", make(chan int)); err == nil {
+		t.Errorf("expected error for a channel")
+	}
+}
+
+func TestSetOverwritesGlobal(t *testing.T) {
+	in := New()
+	in.Set("limit", int64(1))
+	if _, err := in.Run("let getLimit = fn() { limit }; let counter = 0; let bump = fn() { counter = counter + 1 };"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	in.Set("limit", int64(2))
+	result, err := in.Call("getLimit")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(2))
+
+	in.Set("counter", int64(100))
+	result, err = in.Call("bump")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(101))
+}
+
+func TestRegister(t *testing.T) {
+	in := New()
+	in.Register("twice", func(args ...object.Object) object.Object {
+		i := args[0].(*object.Integer)
+		return &object.Integer{Value: 2 * i.Value}
+	})
+	in.RegisterFunc("join", func(args ...interface{}) (interface{}, error) {
+		parts := []string{}
+		for _, arg := range args[0].([]interface{}) {
+			parts = append(parts, fmt.Sprint(arg))
+		}
+		return strings.Join(parts, args[1].(string)), nil
+	})
+	in.RegisterFunc("fail", func(args ...interface{}) (interface{}, error) {
+		return nil, errors.New("failed on purpose")
+	})
+
+	result, err := in.Run(`join([twice(2), "x", 1.5], "-")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, "4-x-1.5")
+
+	_, err = in.Run(`fail()`)
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) || rerr.Message != "fail: failed on purpose" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+
+	_, err = in.Run(`join([fn() {}], "")`)
+	if !errors.As(err, &rerr) || rerr.Message != "join: argument 0: cannot convert CLOSURE to a Go value" {
+		t.Errorf("wrong error. got=%T (%v)", err, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New()
+	in.Register("twice", func(args ...object.Object) object.Object {
+		i := args[0].(*object.Integer)
+		return &object.Integer{Value: 2 * i.Value}
+	})
+	_, err := in.Run(`
+	let counter = 0;
+	let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+	let count = fn() { counter = counter + 1; counter };
+	let fail = fn() { 1 + true };
+	`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	result, err := in.Call("sum", 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(5050))
+
+	result, err = in.Call("twice", int64(21))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(42))
+
+	in.Call("count")
+	result, err = in.Call("count")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(2))
+	counter, _ := in.Get("counter")
+	testValue(t, counter, int64(2))
+
+	_, err = in.Call("fail")
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not RuntimeError. got=%T (%+v)", err, err)
+	}
+	if rerr.Message != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", rerr.Message)
+	}
+	if rerr.Trace[0].Function != "fail" {
+		t.Errorf("wrong function in trace. got=%q", rerr.Trace[0].Function)
+	}
+
+	if _, err := in.Call("sum", 1, 2); err == nil {
+		t.Errorf("expected error for wrong number of arguments")
+	}
+	if _, err := in.Call("nothing"); err == nil {
+		t.Errorf("expected error for undefined function")
+	}
+
+	// the interpreter is still usable after errors
+	result, err = in.Run("sum(3)")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(6))
+}
+
+func TestLimits(t *testing.T) {
+	in := New()
+	_, err := in.Run("let loop = fn() { for (x in [1]) { loop() } };")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	limits := vm.DefaultLimits
+	limits.Instructions = 1000
+	in.SetLimits(limits)
+	_, err = in.Run("let i = 0; while (true) { i = i + 1; }")
+	var limitErr *object.InstructionLimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("error is not InstructionLimitError. got=%T (%+v)", err, err)
+	}
+
+	in.SetLimits(vm.DefaultLimits)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = in.CallContext(ctx, "loop")
+	var cancelErr *object.CancelledError
+	if !errors.As(err, &cancelErr) {
+		t.Errorf("error is not CancelledError. got=%T (%+v)", err, err)
+	}
+}
+
+func TestPartialLimits(t *testing.T) {
+	in := New()
+	in.SetLimits(vm.Limits{Instructions: 1000000})
+	result, err := in.Run("let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(100) + 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	testValue(t, result, int64(101))
+}
+
+func TestFromObjectErrors(t *testing.T) {
+	hash := &object.Hash{}
+	key := &object.Integer{Value: 1}
+	hash.Set(key, key)
+
+	if _, err := FromObject(hash); err == nil {
+		t.Errorf("expected error for integer hash keys")
+	}
+	if _, err := FromObject(&object.Builtin{}); err == nil {
+		t.Errorf("expected error for builtins")
+	}
+}
+
+func testValue(t *testing.T, obj object.Object, expected interface{}) {
+	t.Helper()
+
+	value, err := FromObject(obj)
+	if err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("wrong value. want=%#v, got=%#v", expected, value)
+	}
+}
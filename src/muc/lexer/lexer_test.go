@@ -127,4 +127,307 @@ macro(x, y) { x + y }
 				i, tt.expectedLiteral, tok.Literal)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestTokenPosition(t *testing.T) {
+	input := `let x = 5;
+  "foo" == x
+`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLine	int
+		expectedColumn	int
+	}{
+		{token.LET, 1, 1},
+		{token.ID, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.STRING, 2, 3},
+		{token.EQUAL, 2, 9},
+		{token.ID, 2, 12},
+		{token.EOF, 3, 1},
+	}
+
+	l := NewWithFile(input, "test.mua")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+		if tok.File != "test.mua" {
+			t.Fatalf("tests[%d] - file wrong. expected=%q, got=%q", i, "test.mua", tok.File)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+/* block
+   comment */ x / 2
+/* outer /* nested */ still comment */ x
+`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.ID, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.ID, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.ID, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expectedComments := []string{
+		"// leading comment",
+		"// trailing comment",
+		"/* block\n   comment */",
+		"/* outer /* nested */ still comment */",
+	}
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+	for i, expected := range expectedComments {
+		if comments[i].Type != token.COMMENT || comments[i].Literal != expected {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%q", i, expected, comments[i].Literal)
+		}
+	}
+	if comments[1].Line != 2 || comments[1].Column != 12 {
+		t.Errorf("comment position wrong. expected=2:12, got=%d:%d", comments[1].Line, comments[1].Column)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 1; /* /* */ never closed")
+
+	for i := 0; i < 5; i++ {
+		l.NextToken()
+	}
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+	if tok.Literal != "unterminated block comment" {
+		t.Fatalf("literal wrong. got=%q", tok.Literal)
+	}
+	if tok.Column != 12 {
+		t.Fatalf("column wrong. expected=12, got=%d", tok.Column)
+	}
+	if tok = l.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input			string
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{`"foo bar"`, token.STRING, "foo bar"},
+		{`"a\nb\tc\rd"`, token.STRING, "a\nb\tc\rd"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{48}\u{49}"`, token.STRING, "HI"},
+		{`"\u{1F600}"`, token.STRING, "\U0001F600"},
+		{"`raw \\n string`", token.STRING, `raw \n string`},
+		{"`multi\nline`", token.STRING, "multi\nline"},
+		{`"never closed`, token.ILLEGAL, "unterminated string literal"},
+		{`"never closed\`, token.ILLEGAL, "unterminated string literal"},
+		{"`never closed", token.ILLEGAL, "unterminated raw string literal"},
+		{`"bad \q escape"`, token.ILLEGAL, `unknown escape sequence \q`},
+		{`"\u{110000}"`, token.ILLEGAL, `invalid unicode escape \u{110000}`},
+		{`"\u41"`, token.ILLEGAL, `invalid unicode escape, expected \u{...}`},
+		{`"\u{41"`, token.ILLEGAL, `invalid unicode escape, missing }`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok = l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after literal, got=%q (%q)", i, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := `5 3.14 0.5 2e10 6.02e-23 1E+3 7.e 1.x 9223372036854775807 9223372036854775808`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "2e10"},
+		{token.FLOAT, "6.02e-23"},
+		{token.FLOAT, "1E+3"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.ID, "e"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.ID, "x"},
+		{token.INT, "9223372036854775807"},
+		{token.BIGINT, "9223372036854775808"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestArithmeticOperators(t *testing.T) {
+	input := `a % b ** c * d`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{token.ID, "a"},
+		{token.PERCENT, "%"},
+		{token.ID, "b"},
+		{token.POWER, "**"},
+		{token.ID, "c"},
+		{token.ASTERISK, "*"},
+		{token.ID, "d"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComparisonAndLogicalOperators(t *testing.T) {
+	input := `a <= b >= c < d > e && f || g & |`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{token.ID, "a"},
+		{token.LESS_EQ, "<="},
+		{token.ID, "b"},
+		{token.GREATER_EQ, ">="},
+		{token.ID, "c"},
+		{token.LESS, "<"},
+		{token.ID, "d"},
+		{token.GREATER, ">"},
+		{token.ID, "e"},
+		{token.AND, "&&"},
+		{token.ID, "f"},
+		{token.OR, "||"},
+		{token.ID, "g"},
+		{token.ILLEGAL, "&"},
+		{token.ILLEGAL, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNullOperators(t *testing.T) {
+	input := `null ?? a?[b] ? c`
+	tests := []struct {
+		expectedType	token.TokenType
+		expectedLiteral string
+	}{
+		{token.NULL, "null"},
+		{token.NULLISH, "??"},
+		{token.ID, "a"},
+		{token.SAFE_INDEX, "?["},
+		{token.ID, "b"},
+		{token.R_BRACKET, "]"},
+		{token.ILLEGAL, "?"},
+		{token.ID, "c"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
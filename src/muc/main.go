@@ -4,10 +4,26 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
+	"muc/disasm"
 	"muc/repl"
+	"muc/runner"
 )
 
+const usage = `Usage:
+	muc				start the REPL
+	muc run file.mua [args...]	compile and run a script
+	muc build file.mua [-o file.mub]	compile a script to a bytecode file
+	muc exec file.mub [args...]	run a bytecode file
+	muc disasm file.mua|file.mub	print the bytecode of a script
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,4 +32,64 @@ func main() {
 		user.Username)
 	fmt.Printf("Type \"help\" for more information.\n")
 	repl.Start(os.Stdin, os.Stdout)
-}
\ No newline at end of file
+}
+
+// returns the exit status of the command
+func runCommand(command string, args []string) int {
+	switch command {
+	case "run":
+		if len(args) < 1 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		if err := runner.RunFile(args[0], args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "build":
+		if len(args) != 1 && !(len(args) == 3 && args[1] == "-o") {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		output := strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".mub"
+		if len(args) == 3 {
+			output = args[2]
+		}
+		if err := runner.BuildFile(args[0], output); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "exec":
+		if len(args) < 1 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		if err := runner.ExecFile(args[0], args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "disasm":
+		if len(args) != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		bytecode, err := runner.LoadFile(args[0])
+		if err == nil {
+			err = disasm.Disassemble(os.Stdout, bytecode)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	case "help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", command, usage)
+		return 2
+	}
+}
@@ -0,0 +1,175 @@
+package object
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+const BIGINT_OBJ = "BIGINT"
+
+var ErrDivisionByZero = errors.New("division by zero")
+
+// Integers beyond 2^24 bits are refused, `**` would take ages to build them
+const maxBigIntBits = 1 << 24
+
+// BigInt holds the integers out of the int64 range. Results that fit into
+// int64 are always an Integer, so every number has a single representation
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Type() ObjectType { return BIGINT_OBJ }
+func (b *BigInt) Inspect() string  { return b.Value.String() }
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// An Integer if the value fits into int64, a BigInt otherwise
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+// Integer or BigInt
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt:
+		return true
+	}
+	return false
+}
+
+func toBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return obj.Value
+	}
+	return nil
+}
+
+// The nearest float of an Integer or BigInt
+func IntegerToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	}
+	return 0
+}
+
+// Apply +, -, *, /, % or ** to Integer and BigInt operands. Results that
+// overflow int64 are promoted to BigInt, a negative exponent gives a Float
+func IntegerArithmetic(operator string, left, right Object) (Object, error) {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			if result, ok, err := int64Arithmetic(operator, l.Value, r.Value); ok || err != nil {
+				return result, err
+			}
+		}
+	}
+
+	x, y := toBigInt(left), toBigInt(right)
+	z := new(big.Int)
+	switch operator {
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		z.Mul(x, y)
+	case "/", "%":
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		// truncated like the int64 operators
+		if operator == "/" {
+			z.Quo(x, y)
+		} else {
+			z.Rem(x, y)
+		}
+	case "**":
+		if y.Sign() < 0 {
+			return &Float{Value: math.Pow(IntegerToFloat(left), IntegerToFloat(right))}, nil
+		}
+		if x.CmpAbs(big.NewInt(1)) > 0 &&
+			(!y.IsInt64() || y.Int64() > maxBigIntBits / int64(x.BitLen())) {
+			return nil, errors.New("integer too large")
+		}
+		z.Exp(x, y, nil)
+	default:
+		return nil, errors.New("unknown integer operator: " + operator)
+	}
+	return NewInteger(z), nil
+}
+
+// The int64 result, ok is false if the result overflows
+func int64Arithmetic(operator string, a, b int64) (Object, bool, error) {
+	var result int64
+	switch operator {
+	case "+":
+		result = a + b
+		if (result > a) != (b > 0) {
+			return nil, false, nil
+		}
+	case "-":
+		result = a - b
+		if (result < a) != (b > 0) {
+			return nil, false, nil
+		}
+	case "*":
+		if a != 0 && b != 0 {
+			result = a * b
+			if result / b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+				return nil, false, nil
+			}
+		}
+	case "/", "%":
+		if b == 0 {
+			return nil, false, ErrDivisionByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, false, nil
+		}
+		if operator == "/" {
+			result = a / b
+		} else {
+			result = a % b
+		}
+	default:
+		return nil, false, nil
+	}
+	return &Integer{Value: result}, true, nil
+}
+
+func NegateInteger(obj Object) Object {
+	if integer, ok := obj.(*Integer); ok && integer.Value != math.MinInt64 {
+		return &Integer{Value: -integer.Value}
+	}
+	return NewInteger(new(big.Int).Neg(toBigInt(obj)))
+}
+
+// -1, 0 or 1 as left is less, equal or greater than right
+func CompareIntegers(left, right Object) int {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			switch {
+			case l.Value < r.Value:
+				return -1
+			case l.Value > r.Value:
+				return 1
+			}
+			return 0
+		}
+	}
+	return toBigInt(left).Cmp(toBigInt(right))
+}
@@ -2,6 +2,9 @@ package object
 
 import (
 	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
 )
 
 var Builtins = []struct {
@@ -19,7 +22,8 @@ var Builtins = []struct {
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				// characters, like the indices of the string builtins
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -35,23 +39,53 @@ var Builtins = []struct {
 			return nil
 		}},
 	},
-	{
-		"first",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `first must be ARRAY, got=%s`", args[0].Type())
-			}
-
-			arr := args[0].(*Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-			return nil
-		}},
-	},
+	{"first", &Builtin{Fn: arrayFirst}},
+	{"map", &Builtin{HigherOrder: arrayMap}},
+	{"filter", &Builtin{HigherOrder: arrayFilter}},
+	{"reduce", &Builtin{HigherOrder: arrayReduce}},
+	{"sort", &Builtin{HigherOrder: arraySort}},
+	{"last", &Builtin{Fn: arrayLast}},
+	{"rest", &Builtin{Fn: arrayRest}},
+	{"push", &Builtin{Fn: arrayPush}},
+	{"slice", &Builtin{Fn: arraySlice}},
+	{"concat", &Builtin{Fn: arrayConcat}},
+	{"reverse", &Builtin{Fn: arrayReverse}},
+	{"contains", &Builtin{Fn: builtinContains}},
+	{"index_of", &Builtin{Fn: arrayIndexOf}},
+	{"join", &Builtin{Fn: arrayJoin}},
+	{"range", &Builtin{Fn: arrayRange, Cost: rangeCost}},
+	{"zip", &Builtin{Fn: arrayZip}},
+	{"flatten", &Builtin{Fn: arrayFlatten}},
+	{"unique", &Builtin{Fn: arrayUnique}},
+	{"keys", &Builtin{Fn: hashKeys}},
+	{"values", &Builtin{Fn: hashValues}},
+	{"items", &Builtin{Fn: hashItems}},
+	{"has_key", &Builtin{Fn: hashHasKey}},
+	{"delete", &Builtin{Fn: hashDelete}},
+	{"merge", &Builtin{Fn: hashMerge}},
+	{"split", &Builtin{Fn: stringSplit}},
+	{"trim", &Builtin{Fn: stringFunction("trim", strings.TrimSpace)}},
+	{"upper", &Builtin{Fn: stringFunction("upper", strings.ToUpper)}},
+	{"lower", &Builtin{Fn: stringFunction("lower", strings.ToLower)}},
+	{"replace", &Builtin{Fn: stringReplace}},
+	{"starts_with", &Builtin{Fn: stringPredicate("starts_with", strings.HasPrefix)}},
+	{"ends_with", &Builtin{Fn: stringPredicate("ends_with", strings.HasSuffix)}},
+	{"find", &Builtin{Fn: stringFind}},
+	{"repeat", &Builtin{Fn: stringRepeat, Cost: repeatCost}},
+	{"chars", &Builtin{Fn: stringChars}},
+	{"substr", &Builtin{Fn: stringSubstr}},
+	{"format", &Builtin{Fn: stringFormat}},
+	{"to_string", &Builtin{Fn: toString}},
+	{"parse_int", &Builtin{Fn: parseInt}},
+	{"abs", &Builtin{Fn: mathAbs}},
+	{"min", &Builtin{Fn: mathExtreme("min", false)}},
+	{"max", &Builtin{Fn: mathExtreme("max", true)}},
+	{"pow", &Builtin{Fn: mathPow}},
+	{"sqrt", &Builtin{Fn: mathSqrt}},
+	{"floor", &Builtin{Fn: mathRound("floor", math.Floor)}},
+	{"ceil", &Builtin{Fn: mathRound("ceil", math.Ceil)}},
+	{"clamp", &Builtin{Fn: mathClamp}},
+	{"gcd", &Builtin{Fn: mathGcd}},
 }
 
 func newError(format string, a ...interface{}) *Error {
@@ -0,0 +1,154 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// Math builtins keep integers as integers where the result allows it
+
+func numberArgument(name string, args []Object, i int) (float64, *Error) {
+	switch arg := args[i].(type) {
+	case *Integer, *BigInt:
+		return IntegerToFloat(arg), nil
+	case *Float:
+		return arg.Value, nil
+	}
+	return 0, newError("argument %d to `%s` must be a number, got %s", i+1, name, args[i].Type())
+}
+
+func mathAbs(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	if IsInteger(args[0]) {
+		if CompareIntegers(args[0], &Integer{Value: 0}) < 0 {
+			return NegateInteger(args[0])
+		}
+		return args[0]
+	}
+	value, err := numberArgument("abs", args, 0)
+	if err != nil { return err }
+	return &Float{Value: math.Abs(value)}
+}
+
+// A builtin picking the smallest or the largest of its arguments, or of
+// the elements of a single array argument
+func mathExtreme(name string, largest bool) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) == 1 {
+			if arr, ok := args[0].(*Array); ok {
+				args = arr.Elements
+			}
+		}
+		if len(args) == 0 {
+			return newError("`%s` of no values", name)
+		}
+
+		result := args[0]
+		for _, arg := range args[1:] {
+			less, err := lessThan(arg, result)
+			if largest {
+				less, err = lessThan(result, arg)
+			}
+			if err != nil {
+				return newError("%s", err)
+			}
+			if less {
+				result = arg
+			}
+		}
+		return result
+	}
+}
+
+func mathPow(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	if IsInteger(args[0]) && IsInteger(args[1]) {
+		result, err := IntegerArithmetic("**", args[0], args[1])
+		if err != nil {
+			return newError("%s", err)
+		}
+		return result
+	}
+
+	x, err := numberArgument("pow", args, 0)
+	if err != nil { return err }
+	y, err := numberArgument("pow", args, 1)
+	if err != nil { return err }
+	return &Float{Value: math.Pow(x, y)}
+}
+
+func mathSqrt(args ...Object) Object {
+	if len(args) != 1 {
+		return wrongNumberOfArguments(len(args), "1")
+	}
+	value, err := numberArgument("sqrt", args, 0)
+	if err != nil { return err }
+
+	if value < 0 {
+		return newError("`sqrt` of negative number %s", args[0].Inspect())
+	}
+	return &Float{Value: math.Sqrt(value)}
+}
+
+// A builtin rounding a number to an integer
+func mathRound(name string, round func(float64) float64) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 1 {
+			return wrongNumberOfArguments(len(args), "1")
+		}
+		if IsInteger(args[0]) {
+			return args[0]
+		}
+		value, err := numberArgument(name, args, 0)
+		if err != nil { return err }
+
+		value = round(value)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return newError("`%s` of %s is not an integer", name, args[0].Inspect())
+		}
+		integer, _ := big.NewFloat(value).Int(nil)
+		return NewInteger(integer)
+	}
+}
+
+// clamp(x, low, high) limits x to the range [low, high]
+func mathClamp(args ...Object) Object {
+	if len(args) != 3 {
+		return wrongNumberOfArguments(len(args), "3")
+	}
+	for i := range args {
+		if _, err := numberArgument("clamp", args, i); err != nil {
+			return err
+		}
+	}
+
+	value, low, high := args[0], args[1], args[2]
+	if less, _ := lessThan(high, low); less {
+		return newError("`clamp` with low %s greater than high %s", low.Inspect(), high.Inspect())
+	}
+	if less, _ := lessThan(value, low); less {
+		return low
+	}
+	if less, _ := lessThan(high, value); less {
+		return high
+	}
+	return value
+}
+
+// The greatest common divisor of two integers, never negative
+func mathGcd(args ...Object) Object {
+	if len(args) != 2 {
+		return wrongNumberOfArguments(len(args), "2")
+	}
+	a, err := integerArgument("gcd", args, 0)
+	if err != nil { return err }
+	b, err := integerArgument("gcd", args, 1)
+	if err != nil { return err }
+
+	// gcd(MinInt64, 0) is 2^63, which does not fit into int64
+	return NewInteger(new(big.Int).GCD(nil, nil, big.NewInt(a), big.NewInt(b)))
+}
@@ -0,0 +1,121 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Equal is the `==` of both engines. Numbers are equal by value whatever
+// their type, strings, arrays and hashes by their contents, functions and
+// builtins only to themselves
+func Equal(left, right Object) bool {
+	return equal(left, right, nil)
+}
+
+// seen holds the pairs of arrays and hashes under comparison, a pair met
+// again is part of a cycle and taken as equal
+func equal(left, right Object, seen map[[2]Object]bool) bool {
+	if isNumber(left) && isNumber(right) {
+		result, _ := Compare(left, right)
+		return result == 0 && !isNaN(left) && !isNaN(right)
+	}
+
+	switch left := left.(type) {
+	case *String:
+		right, ok := right.(*String)
+		return ok && left.Value == right.Value
+	case *Boolean:
+		right, ok := right.(*Boolean)
+		return ok && left.Value == right.Value
+	case *Null:
+		_, ok := right.(*Null)
+		return ok
+	case *Array:
+		right, ok := right.(*Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		if left == right || seen[[2]Object{left, right}] {
+			return true
+		}
+		seen = markSeen(seen, left, right)
+		for i, element := range left.Elements {
+			if !equal(element, right.Elements[i], seen) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		right, ok := right.(*Hash)
+		if !ok || left.Len() != right.Len() {
+			return false
+		}
+		if left == right || seen[[2]Object{left, right}] {
+			return true
+		}
+		seen = markSeen(seen, left, right)
+		for _, pair := range left.Pairs() {
+			value, ok := right.Get(pair.Key.(Hashable))
+			if !ok || !equal(pair.Value, value, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
+
+func markSeen(seen map[[2]Object]bool, left, right Object) map[[2]Object]bool {
+	if seen == nil {
+		seen = make(map[[2]Object]bool)
+	}
+	seen[[2]Object{left, right}] = true
+	return seen
+}
+
+func isNumber(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt, *Float:
+		return true
+	}
+	return false
+}
+
+func isNaN(obj Object) bool {
+	float, ok := obj.(*Float)
+	return ok && float.Value != float.Value
+}
+
+// Compare orders numbers by value and strings lexicographically by bytes.
+// The result is -1, 0 or 1 as left is less, equal or greater than right
+func Compare(left, right Object) (int, error) {
+	switch {
+	case IsInteger(left) && IsInteger(right):
+		return CompareIntegers(left, right), nil
+	case isNumber(left) && isNumber(right):
+		if isNaN(left) || isNaN(right) {
+			return 0, nil
+		}
+		return exactNumber(left).Cmp(exactNumber(right)), nil
+	}
+
+	if left, ok := left.(*String); ok {
+		if right, ok := right.(*String); ok {
+			return strings.Compare(left.Value, right.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", left.Type(), right.Type())
+}
+
+// Integers and floats are compared without rounding, so a float is only
+// equal to the integer of the same value
+func exactNumber(obj Object) *big.Float {
+	switch obj := obj.(type) {
+	case *Float:
+		return new(big.Float).SetFloat64(obj.Value)
+	case *BigInt:
+		return new(big.Float).SetInt(obj.Value)
+	}
+	return new(big.Float).SetInt64(obj.(*Integer).Value)
+}
@@ -0,0 +1,157 @@
+package object
+
+import (
+	"context"
+	"fmt"
+)
+
+// Execution limits for untrusted scripts, zero means unlimited
+type Limits struct {
+	Instructions	int64	// VM instructions, or nodes evaluated by the evaluator
+	CallDepth		int		// nested function calls
+	Objects			int64	// allocated objects, see Cost
+}
+
+// The context of the execution was cancelled or its deadline passed
+type CancelledError struct {
+	Err error
+}
+
+func (e *CancelledError) Error() string { return "execution cancelled: " + e.Err.Error() }
+func (e *CancelledError) Unwrap() error { return e.Err }
+
+type InstructionLimitError struct {
+	Limit int64
+}
+
+func (e *InstructionLimitError) Error() string {
+	return fmt.Sprintf("instruction limit of %d exceeded", e.Limit)
+}
+
+type CallDepthError struct {
+	Limit int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("stack overflow: call depth limit of %d exceeded", e.Limit)
+}
+
+type ObjectLimitError struct {
+	Limit int64
+}
+
+func (e *ObjectLimitError) Error() string {
+	return fmt.Sprintf("object limit of %d exceeded", e.Limit)
+}
+
+// The context is polled once every that many instructions
+const cancelCheckInterval = 256
+
+// Tracks one execution against its context and limits. The first error is
+// sticky, every later check returns it again
+type Budget struct {
+	ctx		context.Context
+	limits	Limits
+
+	instructions	int64
+	depth			int
+	objects			int64
+
+	err error
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{ctx: ctx, limits: limits}
+}
+
+// Count one instruction
+func (b *Budget) Step() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.instructions++
+	if b.limits.Instructions > 0 && b.instructions > b.limits.Instructions {
+		b.err = &InstructionLimitError{Limit: b.limits.Instructions}
+	} else if b.instructions % cancelCheckInterval == 0 {
+		b.checkContext()
+	}
+	return b.err
+}
+
+// Count one nested call, every Enter is paired with a Leave
+func (b *Budget) Enter() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.depth++
+	if b.limits.CallDepth > 0 && b.depth > b.limits.CallDepth {
+		b.err = &CallDepthError{Limit: b.limits.CallDepth}
+	}
+	return b.err
+}
+
+func (b *Budget) Leave() {
+	b.depth--
+}
+
+// Count the cost of a new object
+func (b *Budget) Allocate(obj Object) error {
+	cost := Cost(obj)
+	if err := b.Check(cost); err != nil {
+		return err
+	}
+	b.objects += cost
+	return nil
+}
+
+// Fail if objects of that cost would exceed the limit, without counting
+// them. Builtins are checked this way before they build their result
+func (b *Budget) Check(cost int64) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.limits.Objects > 0 && cost > b.limits.Objects - b.objects {
+		b.err = &ObjectLimitError{Limit: b.limits.Objects}
+	}
+	return b.err
+}
+
+// The first error of the execution, including a cancelled context
+func (b *Budget) Err() error {
+	if b.err == nil {
+		b.checkContext()
+	}
+	return b.err
+}
+
+func (b *Budget) checkContext() {
+	if err := b.ctx.Err(); err != nil {
+		b.err = &CancelledError{Err: err}
+	}
+}
+
+// Strings and big integers count one more object for every that many bytes
+const bytesPerObject = 16
+
+// The objects counted for a new value: containers also count their slots,
+// strings and big integers their bytes, shared singletons and errors are free
+func Cost(obj Object) int64 {
+	switch obj := obj.(type) {
+	case nil, *Boolean, *Null, *Error:
+		return 0
+	case *String:
+		return StringCost(int64(len(obj.Value)))
+	case *BigInt:
+		return 1 + int64(obj.Value.BitLen() / 8 / bytesPerObject)
+	case *Array:
+		return 1 + int64(len(obj.Elements))
+	case *Hash:
+		return 1 + 2 * int64(obj.Len())
+	}
+	return 1
+}
+
+// The cost of a string of that many bytes, for builtins estimating their result
+func StringCost(length int64) int64 {
+	return 1 + length / bytesPerObject
+}
@@ -2,10 +2,15 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"muc/ast"
 	"muc/code"
+	"muc/token"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +18,7 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ 	 = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	NULL_OBJ         = "NULL"
@@ -23,11 +29,16 @@ const (
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
 
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
+	ITERATOR_OBJ     = "ITERATOR"
+
 	QUOTE_OBJ        = "QUOTE"
 	MACRO_OBJ        = "MACRO"
 
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ      = "CLOSURE"
+	CELL_OBJ         = "CELL"
 )
 
 type Object interface {
@@ -35,11 +46,42 @@ type Object interface {
 	Inspect() string
 }
 
-// Check If it can be a HASH's key
+// Check If it can be a HASH's key, use AsHashable for arrays
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
+// The object as a hash key. Arrays are keys if all their elements are,
+// recursively, so they work as tuples
+func AsHashable(obj Object) (Hashable, bool) {
+	if arr, ok := obj.(*Array); ok {
+		return arr, hashableArray(arr, map[*Array]bool{})
+	}
+	key, ok := obj.(Hashable)
+	return key, ok
+}
+
+// path holds the enclosing arrays, an array containing itself is no key
+func hashableArray(arr *Array, path map[*Array]bool) bool {
+	if path[arr] {
+		return false
+	}
+	path[arr] = true
+	defer delete(path, arr)
+
+	for _, element := range arr.Elements {
+		if inner, ok := element.(*Array); ok {
+			if !hashableArray(inner, path) {
+				return false
+			}
+		} else if _, ok := element.(Hashable); !ok {
+			return false
+		}
+	}
+	return true
+}
+
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
@@ -55,6 +97,31 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Inspect() string {
+	// keep the decimal point, so 2.0 does not look like an integer
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEIN") {
+		s += ".0"
+	}
+	return s
+}
+// An integral float has the key of the equal integer, and -0.0 that of 0
+func (f *Float) HashKey() HashKey {
+	switch {
+	case f.Value >= -(1 << 63) && f.Value < 1 << 63 && f.Value == math.Trunc(f.Value):
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	case f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0):
+		integer, _ := new(big.Float).SetFloat64(f.Value).Int(nil)
+		return (&BigInt{Value: integer}).HashKey()
+	}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -71,6 +138,20 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: uint64(value)}
 }
 
+// Shared by the engines and the builtins, booleans are compared by identity
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func nativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
 type String struct {
 	Value string
 }
@@ -95,8 +176,20 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// break and continue travel up to the enclosing loop like ReturnValue
+type Break struct {}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct {}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Pos		token.Position	// set by the evaluator, where the error happened
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -125,6 +218,24 @@ func (f *Function) Inspect() string {
 type BuiltinFunction func(args ...Object) Object
 type Builtin struct {
 	Fn BuiltinFunction
+	HigherOrder HigherOrderFunction	// instead of Fn, for builtins calling back into the script
+	Cost func(args ...Object) int64	// optional estimate of the result, checked against the budget before the call
+}
+
+// Runs functions of the script for builtins, implemented by the VM and the evaluator
+type Caller interface {
+	Call(fn Object, args ...Object) (Object, error)
+}
+
+// A builtin that takes functions of the script as arguments. An error of
+// the caller must be returned right away, the engine reports it
+type HigherOrderFunction func(caller Caller, args ...Object) Object
+
+func (b *Builtin) Call(caller Caller, args ...Object) Object {
+	if b.HigherOrder != nil {
+		return b.HigherOrder(caller, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -147,13 +258,162 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// Combines the hash keys of the elements, see AsHashable
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, element := range ao.Elements {
+		if key, ok := element.(Hashable); ok {
+			hashKey := key.HashKey()
+			h.Write([]byte(hashKey.Type))
+			binary.BigEndian.PutUint64(buf, hashKey.Value)
+			h.Write(buf)
+		}
+	}
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
+// Array keys are copied, changing the array later does not change the key
+func frozenKey(key Hashable) Hashable {
+	arr, ok := key.(*Array)
+	if !ok {
+		return key
+	}
+	elements := make([]Object, len(arr.Elements))
+	for i, element := range arr.Elements {
+		if inner, ok := element.(*Array); ok {
+			element = frozenKey(inner)
+		}
+		elements[i] = element
+	}
+	return &Array{Elements: elements}
+}
+
+// Iterator walks a snapshot of the elements visited by a for-in loop
+type Iterator struct {
+	Elements []Object
+	index    int
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return fmt.Sprintf("Iterator[%p]", it) }
+
+func (it *Iterator) Next() (Object, bool) {
+	if it.index >= len(it.Elements) {
+		return nil, false
+	}
+	it.index++
+	return it.Elements[it.index-1], true
+}
+
+// Array elements, String characters or Hash keys
+func NewIterator(obj Object) (*Iterator, bool) {
+	var elements []Object
+
+	switch obj := obj.(type) {
+	case *Array:
+		elements = make([]Object, len(obj.Elements))
+		copy(elements, obj.Elements)
+	case *String:
+		for _, ch := range obj.Value {
+			elements = append(elements, &String{Value: string(ch)})
+		}
+	case *Hash:
+		for _, pair := range obj.Pairs() {
+			elements = append(elements, pair.Key)
+		}
+	default:
+		return nil, false
+	}
+
+	return &Iterator{Elements: elements}, true
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash keeps its pairs in insertion order, setting a key again keeps its
+// place. Keys with the same HashKey share a bucket and are told apart by
+// their values. The zero value is an empty hash
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	buckets	map[HashKey][]*HashPair
+	pairs	[]*HashPair		// in insertion order
+}
+
+func (h *Hash) Len() int { return len(h.pairs) }
+
+func (h *Hash) find(key Hashable) (HashKey, int) {
+	hashKey := key.HashKey()
+	for i, pair := range h.buckets[hashKey] {
+		if sameKey(pair.Key, key) {
+			return hashKey, i
+		}
+	}
+	return hashKey, -1
+}
+
+// Keys are the same if they are Equal, NaN is compared by its bits like
+// its HashKey so it finds itself
+func sameKey(left, right Object) bool {
+	if isNaN(left) && isNaN(right) {
+		return math.Float64bits(left.(*Float).Value) == math.Float64bits(right.(*Float).Value)
+	}
+	return left == right || Equal(left, right)
+}
+
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	hashKey, i := h.find(key)
+	if i < 0 {
+		return nil, false
+	}
+	return h.buckets[hashKey][i].Value, true
+}
+
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey, i := h.find(key)
+	if i >= 0 {
+		h.buckets[hashKey][i].Value = value
+		return
+	}
+	if h.buckets == nil {
+		h.buckets = make(map[HashKey][]*HashPair)
+	}
+	pair := &HashPair{Key: frozenKey(key), Value: value}
+	h.buckets[hashKey] = append(h.buckets[hashKey], pair)
+	h.pairs = append(h.pairs, pair)
+}
+
+// Remove the pair of key, false if there is none
+func (h *Hash) Delete(key Hashable) bool {
+	hashKey, i := h.find(key)
+	if i < 0 {
+		return false
+	}
+	bucket := h.buckets[hashKey]
+	pair := bucket[i]
+	if len(bucket) == 1 {
+		delete(h.buckets, hashKey)
+	} else {
+		h.buckets[hashKey] = append(bucket[:i:i], bucket[i+1:]...)
+	}
+	for i, p := range h.pairs {
+		if p == pair {
+			h.pairs = append(h.pairs[:i], h.pairs[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// All pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.pairs))
+	for i, pair := range h.pairs {
+		pairs[i] = *pair
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -161,7 +421,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Pairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 	out.WriteString("{" + strings.Join(pairs, ", ") + "}")
@@ -201,6 +461,8 @@ type CompiledFunction struct {
 	Instructions code.Instructions
 	NumLocals	int		// pre-allocated local variables in stack ( like C89)
 	NumParameters int
+	Name		string			// empty for anonymous functions
+	Lines		code.LineTable	// source positions of the instructions
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -216,4 +478,15 @@ type Closure struct {
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ}
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell boxes a local variable captured by closures, so that assignments
+// are shared between the enclosing function and all of its closures
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
 }
\ No newline at end of file
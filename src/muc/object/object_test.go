@@ -0,0 +1,117 @@
+package object
+
+import (
+	"math"
+	"testing"
+)
+
+// A key whose hash always collides with the other collidingKeys
+type collidingKey struct {
+	name string
+}
+
+func (c *collidingKey) Type() ObjectType { return "COLLIDING" }
+func (c *collidingKey) Inspect() string  { return c.name }
+func (c *collidingKey) HashKey() HashKey {
+	return HashKey{Type: c.Type(), Value: 1}
+}
+
+func TestHashCollisions(t *testing.T) {
+	a, b, c := &collidingKey{"a"}, &collidingKey{"b"}, &collidingKey{"c"}
+	hash := &Hash{}
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(c, &Integer{Value: 3})
+	hash.Set(a, &Integer{Value: 4})
+
+	if hash.Len() != 3 {
+		t.Fatalf("hash has wrong length. want=3, got=%d", hash.Len())
+	}
+	tests := []struct {
+		key      Hashable
+		expected int64
+	}{
+		{a, 4},
+		{b, 2},
+		{c, 3},
+	}
+	for _, tt := range tests {
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Fatalf("no value for %s", tt.key.Inspect())
+		}
+		if value.(*Integer).Value != tt.expected {
+			t.Errorf("wrong value for %s. want=%d, got=%s", tt.key.Inspect(), tt.expected, value.Inspect())
+		}
+	}
+	if _, ok := hash.Get(&collidingKey{"d"}); ok {
+		t.Errorf("found a value for a key that was never set")
+	}
+
+	if !hash.Delete(b) {
+		t.Fatalf("b was not deleted")
+	}
+	if hash.Delete(b) {
+		t.Errorf("b was deleted twice")
+	}
+	if _, ok := hash.Get(c); !ok {
+		t.Errorf("c was lost when deleting b")
+	}
+	if hash.Inspect() != "{a: 4, c: 3}" {
+		t.Errorf("wrong pairs after delete. got=%s", hash.Inspect())
+	}
+}
+
+func TestArrayKeys(t *testing.T) {
+	key := &Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "a"}}}}}
+	hash := &Hash{}
+	hash.Set(key, TRUE)
+
+	key.Elements[0] = &Integer{Value: 2}
+	if _, ok := hash.Get(key); ok {
+		t.Errorf("changing the array changed the key")
+	}
+	same := &Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "a"}}}}}
+	if _, ok := hash.Get(same); !ok {
+		t.Errorf("no value for an equal array")
+	}
+
+	cyclic := &Array{Elements: []Object{&Integer{Value: 1}}}
+	cyclic.Elements[0] = cyclic
+	unhashable := []Object{
+		&Array{Elements: []Object{&Builtin{}}},
+		&Array{Elements: []Object{&Array{Elements: []Object{&Hash{}}}}},
+		cyclic,
+	}
+	for i, obj := range unhashable {
+		if _, ok := AsHashable(obj); ok {
+			t.Errorf("unhashable[%d] is usable as hash key", i)
+		}
+	}
+}
+
+func TestNumberKeys(t *testing.T) {
+	nan := math.NaN()
+	hash := &Hash{}
+	hash.Set(&Integer{Value: 1}, TRUE)
+	hash.Set(&Float{Value: 0}, TRUE)
+	hash.Set(&Float{Value: nan}, TRUE)
+
+	found := []Hashable{
+		&Float{Value: 1},
+		&Float{Value: math.Copysign(0, -1)},
+		&Integer{Value: 0},
+		&Float{Value: nan},
+	}
+	for _, key := range found {
+		if _, ok := hash.Get(key); !ok {
+			t.Errorf("no value for %s", key.Inspect())
+		}
+	}
+	if _, ok := hash.Get(&Float{Value: 1.5}); ok {
+		t.Errorf("found a value for 1.5")
+	}
+	if hash.Len() != 3 {
+		t.Errorf("hash has wrong length. want=3, got=%d", hash.Len())
+	}
+}
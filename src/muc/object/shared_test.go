@@ -0,0 +1,40 @@
+package object
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The builtin library is copied to mua/object, only the import paths differ.
+// After changing one of these files, copy it with
+//
+//	sed 's/"muc\//"mua\//' muc/object/FILE > mua/object/FILE
+var sharedFiles = []string{
+	"bigint.go",
+	"builtins.go",
+	"builtins_array.go",
+	"builtins_hash.go",
+	"builtins_math.go",
+	"builtins_string.go",
+	"compare.go",
+	"environment.go",
+	"limits.go",
+}
+
+func TestSharedFilesMatchMua(t *testing.T) {
+	for _, name := range sharedFiles {
+		ours, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := ioutil.ReadFile(filepath.Join("..", "..", "mua", "object", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bytes.Replace(ours, []byte(`"muc/`), []byte(`"mua/`), -1), theirs) {
+			t.Errorf("mua/object/%s differs from muc/object/%s", name, name)
+		}
+	}
+}
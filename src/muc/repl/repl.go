@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"muc/ast"
 	"muc/compiler"
 	"muc/lexer"
 	"muc/object"
@@ -17,7 +18,7 @@ func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 
 	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
+	globals := []object.Object{}
 	symbolTable := compiler.NewSymbolTable()
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
@@ -52,15 +53,30 @@ func Start(in io.Reader, out io.Writer) {
 		machine := vm.NewWithGlobalsState(bytecode, globals)
 
 		err = machine.Run()
+		globals = machine.Globals()
 		if err != nil {
 			fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
+			if rerr, ok := err.(*vm.RuntimeError); ok {
+				io.WriteString(out, rerr.StackTrace())
+			}
 			continue
 		}
 
 		lastPopped := machine.LastPoppedStackElem()
-		io.WriteString(out, lastPopped.Inspect())
-		io.WriteString(out, "\n")
+		if lastPopped != nil && endsWithExpression(program) {
+			io.WriteString(out, lastPopped.Inspect())
+			io.WriteString(out, "\n")
+		}
+	}
+}
+
+// Only a line ending with an expression has a value to print
+func endsWithExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
 	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
 }
 
 func printParserErrors(out io.Writer, errors []string) {
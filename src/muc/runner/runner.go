@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"muc/compiler"
+	"muc/lexer"
+	"muc/object"
+	"muc/parser"
+	"muc/vm"
+	"strings"
+)
+
+// `args` is the first global defined in front of the script
+const argsIndex = 0
+
+// All parser errors of a script
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+func RunFile(path string, args []string) error {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return Run(string(input), path, args)
+}
+
+// Lex, parse, compile and execute a whole script, the script arguments
+// are exposed to the program as the global array `args`
+func Run(input string, file string, args []string) error {
+	bytecode, err := Compile(input, file)
+	if err != nil {
+		return err
+	}
+	return Exec(bytecode, args)
+}
+
+// Lex, parse and compile a whole script. The global `args` is always
+// defined first, so the bytecode can be executed later by Exec
+func Compile(input string, file string) (*compiler.ByteCode, error) {
+	l := lexer.NewWithFile(input, file)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	symbolTable.Define("args")
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %s", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// Execute the bytecode produced by Compile
+func Exec(bytecode *compiler.ByteCode, args []string) error {
+	globals := make([]object.Object, argsIndex + 1)
+	globals[argsIndex] = argsArray(args)
+
+	machine := vm.NewWithGlobalsState(bytecode, globals)
+	err := machine.Run()
+	if rerr, ok := err.(*vm.RuntimeError); ok {
+		return fmt.Errorf("runtime error: %s\n%s", rerr, strings.TrimSuffix(rerr.StackTrace(), "\n"))
+	}
+	if err != nil {
+		return fmt.Errorf("runtime error: %s", err)
+	}
+	return nil
+}
+
+// Compile the script at `path` and write the bytecode file to `output`
+func BuildFile(path string, output string) error {
+	input, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	bytecode, err := Compile(string(input), path)
+	if err != nil {
+		return err
+	}
+	data, err := bytecode.Serialize()
+	if err != nil {
+		return fmt.Errorf("build error: %s", err)
+	}
+	return ioutil.WriteFile(output, data, 0644)
+}
+
+// Load a bytecode file written by BuildFile and execute it
+func ExecFile(path string, args []string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	bytecode, err := compiler.Deserialize(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return Exec(bytecode, args)
+}
+
+// Load a bytecode file, or compile the script if it is not one
+func LoadFile(path string) (*compiler.ByteCode, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, compiler.Magic) {
+		return Compile(string(data), path)
+	}
+	bytecode, err := compiler.Deserialize(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return bytecode, nil
+}
+
+func argsArray(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
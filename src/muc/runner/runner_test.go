@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	input := `
+	let sum = 0;
+	for (arg in args) { sum = sum + len(arg); }
+	if (sum != 5) { sum + true; }
+	`
+	if err := Run(input, "sum.mua", []string{"ab", "cde"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = ;", "parse error:\n\tscript.mua:1:9: no prefix parse function for `;` found"},
+		{"if (true) { 1", "parse error:\n\tscript.mua:1:14: expected next token to be }, got EOF instead"},
+		{"let x = 1;\n1 + true", "runtime error: unsupported types for binary operation: INTEGER BOOLEAN\n\tat <main> (script.mua:2:3, offset 0010)"},
+		{"let x = len(1);\nputs(\"after\")", "runtime error: argument to `len` not supported"},
+		{"range(0, 5, 0)", "runtime error: step of `range` must not be 0\n\tat <main> (script.mua:1:6"},
+		{"let f = fn() { -true };\nf()", "runtime error: unsupported type for negation: BOOLEAN\n\tat f (script.mua:1:16, offset 0001)\n\tat <main> (script.mua:2:2, offset 0010)"},
+	}
+
+	for _, tt := range tests {
+		err := Run(tt.input, "script.mua", nil)
+		if err == nil {
+			t.Fatalf("expected error for %q but resulted in none.", tt.input)
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected prefix=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestRunFileNotFound(t *testing.T) {
+	if err := RunFile("no/such/file.mua", nil); err == nil {
+		t.Fatalf("expected error but resulted in none.")
+	}
+}
+
+func TestBuildAndExecFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "script.mua")
+	output := filepath.Join(dir, "script.mub")
+	input := `
+	let add = fn(a, b) { a + b };
+	let total = add(1.5, 2.5);
+	if (total != 4.0 || len(args) != 1) { total + true; }
+	`
+	if err := ioutil.WriteFile(source, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BuildFile(source, output); err != nil {
+		t.Fatalf("build error: %s", err)
+	}
+	if err := ExecFile(output, []string{"x"}); err != nil {
+		t.Fatalf("exec error: %s", err)
+	}
+	if err := ExecFile(output, nil); err == nil {
+		t.Fatalf("expected runtime error but resulted in none.")
+	}
+	for _, path := range []string{source, output} {
+		bytecode, err := LoadFile(path)
+		if err != nil {
+			t.Fatalf("load error for %s: %s", path, err)
+		}
+		if len(bytecode.Constants) == 0 {
+			t.Fatalf("no constants loaded from %s", path)
+		}
+	}
+	if err := ExecFile(source, nil); err == nil || !strings.Contains(err.Error(), "not a bytecode file") {
+		t.Fatalf("wrong error for a source file. got=%v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"muc/code"
+	"muc/token"
+)
+
+// Traces of deep stacks keep that many innermost and outermost calls
+const traceEnds = 10
+
+// An error raised while executing bytecode, with the call stack at that moment
+type RuntimeError struct {
+	Message	string
+	Trace	[]TraceEntry	// the innermost call is the first
+	Omitted	int				// calls left out after the first traceEnds entries of Trace
+	Err		error			// the cause
+}
+
+func (e *RuntimeError) Error() string { return e.Message }
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// One line per call, like "	at add (script.mua:3:9, offset 0006)". Runs of
+// the same call are merged into one line and omitted calls are counted
+func (e *RuntimeError) StackTrace() string {
+	var out bytes.Buffer
+	for i := 0; i < len(e.Trace); {
+		if e.Omitted > 0 && i == traceEnds {
+			fmt.Fprintf(&out, "\t... %d more frames ...\n", e.Omitted)
+		}
+		entry := e.Trace[i]
+		out.WriteString("\tat " + entry.String() + "\n")
+
+		repeated := 0
+		for i++; i < len(e.Trace) && e.Trace[i] == entry && !(e.Omitted > 0 && i == traceEnds); i++ {
+			repeated++
+		}
+		if repeated > 0 {
+			fmt.Fprintf(&out, "\t... repeated %d more times ...\n", repeated)
+		}
+	}
+	return out.String()
+}
+
+type TraceEntry struct {
+	Function	string
+	Offset		int				// of the failing instruction or the pending call
+	Pos			token.Position	// invalid if the bytecode has no line table
+}
+
+func (te TraceEntry) String() string {
+	if te.Pos.IsValid() {
+		return fmt.Sprintf("%s (%s, offset %04d)", te.Function, te.Pos, te.Offset)
+	}
+	return fmt.Sprintf("%s (offset %04d)", te.Function, te.Offset)
+}
+
+func (vm *VM) newRuntimeError(err error) *RuntimeError {
+	e := &RuntimeError{Message: err.Error(), Err: err}
+	if vm.framesIndex > 2 * traceEnds {
+		e.Omitted = vm.framesIndex - 2 * traceEnds
+	}
+
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		if e.Omitted > 0 && i == vm.framesIndex - 1 - traceEnds {
+			i = traceEnds - 1	// the omitted calls are never decoded
+		}
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		offset := instructionStart(fn.Instructions, frame.ip)
+
+		name := fn.Name
+		if i == 0 {
+			name = "<main>"
+		} else if name == "" {
+			name = "<anonymous>"
+		}
+
+		e.Trace = append(e.Trace, TraceEntry{
+			Function: name,
+			Offset: offset,
+			Pos: fn.Lines.Lookup(offset),
+		})
+	}
+	return e
+}
+
+// The ip of a frame may point at an operand, find where its instruction starts
+func instructionStart(ins code.Instructions, ip int) int {
+	start := 0
+	for start < len(ins) {
+		_, _, width, err := ins.Decode(start)
+		if err != nil || start + width > ip {
+			break
+		}
+		start += width
+	}
+	return start
+}
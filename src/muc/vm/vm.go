@@ -1,19 +1,44 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"muc/code"
 	"muc/compiler"
 	"muc/object"
 )
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
-const StackSize = 2048
+// Default limits, the stacks start small and grow on demand up to them
+const StackSize = 1 << 20
+const MaxFrames = 1 << 16
+
+// Globals are addressed by 2 bytes, they are allocated when first set
 const GlobalsSize = 65536
-const MaxFrames = 1024
+
+const initialStackSize = 256
+const initialFrames = 64
+
+// Limits of a VM, see RunContext for the errors when they are exceeded
+type Limits struct {
+	// zero means the default StackSize and MaxFrames
+	StackSize	int		// values on the stack
+	MaxFrames	int		// nested calls, including the main program
+
+	// zero means unlimited
+	Instructions	int64
+	Objects			int64	// see object.Cost
+}
+
+var DefaultLimits = Limits{StackSize: StackSize, MaxFrames: MaxFrames}
+
+var errStackOverflow = fmt.Errorf("stack overflow")
+// a variable whose `let` never ran, like x in `if (false) { let x = 1 } x`
+var errUnsetVariable = fmt.Errorf("variable used before it is set")
 
 type VM struct {
 	constants		[]object.Object
@@ -25,15 +50,31 @@ type VM struct {
 
 	frames []*Frame
 	framesIndex int
+
+	limits	Limits
+	budget	*object.Budget
 }
 
 func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= vm.limits.MaxFrames {
+		return &object.CallDepthError{Limit: vm.limits.MaxFrames}
+	}
+	if vm.framesIndex == len(vm.frames) {
+		size := 2 * len(vm.frames)
+		if size > vm.limits.MaxFrames {
+			size = vm.limits.MaxFrames
+		}
+		frames := make([]*Frame, size)
+		copy(frames, vm.frames)
+		vm.frames = frames
+	}
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -42,32 +83,71 @@ func (vm *VM) popFrame() *Frame {
 }
 
 func New(bytecode *compiler.ByteCode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
+	frames := make([]*Frame, initialFrames)
 	frames[0] = mainFrame
 
 	return &VM{
 		constants:	  bytecode.Constants,
 
-		stack:	make([]object.Object, StackSize),
+		stack:	make([]object.Object, initialStackSize),
 		sp:		0,
 
-		globals: make([]object.Object, GlobalsSize),
+		globals: []object.Object{},
 		
 		frames: frames,
 		framesIndex: 1,
+
+		limits: DefaultLimits,
 	}
 }
 
+// Continue with the globals of a previous VM, see Globals
 func NewWithGlobalsState(bytecode *compiler.ByteCode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
 	return vm
 }
 
+func (vm *VM) SetLimits(limits Limits) {
+	if limits.StackSize == 0 {
+		limits.StackSize = StackSize
+	}
+	if limits.MaxFrames == 0 {
+		limits.MaxFrames = MaxFrames
+	}
+	vm.limits = limits
+}
+
+// The globals grow when they are set, pass them to the next VM sharing the state
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// Make room for `size` values on the stack
+func (vm *VM) ensureStack(size int) error {
+	if size > vm.limits.StackSize {
+		return errStackOverflow
+	}
+	if size <= len(vm.stack) {
+		return nil
+	}
+	grown := 2 * len(vm.stack)
+	if grown < size {
+		grown = size
+	}
+	if grown > vm.limits.StackSize {
+		grown = vm.limits.StackSize
+	}
+	stack := make([]object.Object, grown)
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+	return nil
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -75,15 +155,44 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Errors are returned as *RuntimeError
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+/**
+Run until the program ends, the context is done or a limit is exceeded.
+The cause of the returned *RuntimeError is then one of *object.CancelledError,
+*object.InstructionLimitError, *object.CallDepthError or *object.ObjectLimitError
+*/
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.budget = object.NewBudget(ctx, object.Limits{
+		Instructions: vm.limits.Instructions,
+		Objects: vm.limits.Objects,
+	})
+
+	err := vm.run()
+	if err == nil {
+		err = vm.budget.Err()
+	}
+	if err != nil {
+		return vm.newRuntimeError(err)
+	}
+	return nil
+}
+
 /**
 Fetch-Decode-Execute
 */
-func (vm *VM) Run() error {
+func (vm *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) - 1 {
+		if err := vm.budget.Step(); err != nil {
+			return err
+		}
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
@@ -110,7 +219,7 @@ func (vm *VM) Run() error {
 			array := vm.buildArray(vm.sp - numElements, vm.sp)
 			vm.sp = vm.sp - numElements
 
-			err := vm.push(array)
+			err := vm.pushNew(array)
 			if err != nil { return err }
 
 		case code.OpHash:
@@ -123,7 +232,7 @@ func (vm *VM) Run() error {
 			}
 			vm.sp = vm.sp - numElements
 
-			err = vm.push(hash)
+			err = vm.pushNew(hash)
 			if err != nil { return err }
 
 		case code.OpIndex:
@@ -133,7 +242,7 @@ func (vm *VM) Run() error {
 			err := vm.executeIndexExpression(left, index)
 			if err != nil { return err }
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -146,7 +255,7 @@ func (vm *VM) Run() error {
 		case code.OpFalse:
 			err := vm.push(False)
 			if err != nil { return err }
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual:
 			err := vm.executeComparison(op)
 			if err != nil { return err }
 		case code.OpBang:
@@ -169,16 +278,37 @@ func (vm *VM) Run() error {
 				vm.currentFrame().ip = pos - 1
 			}
 
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.StackTop().Type() != object.NULL_OBJ {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
+			for int(globalIndex) >= len(vm.globals) {
+				vm.globals = append(vm.globals, nil)
+			}
 			vm.globals[globalIndex] = vm.pop()
 		
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
-			err := vm.push(vm.globals[globalIndex])
+
+			var global object.Object
+			if int(globalIndex) < len(vm.globals) {
+				global = vm.globals[globalIndex]
+			}
+			if global == nil {
+				return errUnsetVariable
+			}
+			err := vm.push(global)
 			if err != nil { return err }
 
 		case code.OpGetLocal:
@@ -186,8 +316,15 @@ func (vm *VM) Run() error {
 			vm.currentFrame().ip += 1
 
 			frame := vm.currentFrame()
-			
-			err := vm.push(vm.stack[frame.basePointer + int(localIndex)])
+			local := vm.stack[frame.basePointer + int(localIndex)]
+			if cell, ok := local.(*object.Cell); ok {
+				local = cell.Value
+			}
+			if local == nil {
+				return errUnsetVariable
+			}
+
+			err := vm.push(local)
 			if err != nil {
 				return err
 			}
@@ -205,9 +342,58 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
+			// a cell, or the enclosing closure itself which is never reassigned
+			free := vm.currentFrame().cl.Free[freeIndex]
+			if cell, ok := free.(*object.Cell); ok {
+				free = cell.Value
+			}
+			if free == nil {
+				return errUnsetVariable
+			}
+			err := vm.push(free)
+
+			if err != nil { return err }
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			currentClosure.Free[freeIndex].(*object.Cell).Value = vm.pop()
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			// box the local on its first capture
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+				if err := vm.budget.Allocate(cell); err != nil { return err }
+			}
+
+			err := vm.push(cell)
+			if err != nil { return err }
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
 
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
+			if err != nil { return err }
+
+		case code.OpCurrentClosure:
+			err := vm.push(vm.currentFrame().cl)
+			if err != nil { return err }
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
 			if err != nil { return err }
 
 		case code.OpCall:
@@ -217,12 +403,24 @@ func (vm *VM) Run() error {
 			err := vm.executeCall(int(numArgs))
 			if err != nil { return err }
 
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil { return err }
+
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
 			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
 
 		case code.OpReturnValue:
 			returnValue := vm.pop()
@@ -252,6 +450,30 @@ func (vm *VM) Run() error {
 
 			err := vm.pushClosure(int(constIndex), int(numFree))
 			if err != nil { return err }
+
+		case code.OpIter:
+			iterable := vm.pop()
+			iterator, ok := object.NewIterator(iterable)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", iterable.Type())
+			}
+
+			err := vm.pushNew(iterator)
+			if err != nil { return err }
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			iterator := vm.pop().(*object.Iterator)
+			elem, ok := iterator.Next()
+			if !ok {
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+
+			err := vm.push(elem)
+			if err != nil { return err }
 		}
 	}
 	return nil
@@ -277,8 +499,10 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	rightType := right.Type()
 
 	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	}
@@ -290,28 +514,67 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER_OBJ || right.Type() == object.INTEGER_OBJ {
+	if object.IsInteger(left) && object.IsInteger(right) {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if isNumber(left) && isNumber(right) {
+		return vm.executeFloatComparison(op, left, right)
+	}
 
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	case code.OpGreaterThan, code.OpGreaterEqual:
+		result, err := object.Compare(left, right)
+		if err != nil {
+			return err
+		}
+		if op == code.OpGreaterThan {
+			return vm.push(nativeBoolToBooleanObject(result > 0))
+		}
+		return vm.push(nativeBoolToBooleanObject(result >= 0))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
 }
 
+var integerOperators = map[code.Opcode]string{
+	code.OpAdd: "+",
+	code.OpSub: "-",
+	code.OpMul: "*",
+	code.OpDiv: "/",
+	code.OpMod: "%",
+	code.OpPow: "**",
+}
+
+// Integer and BigInt operands, results overflowing int64 become BigInt
 func (vm *VM) executeBinaryIntegerOperation(
 	op code.Opcode, 
 	left, right object.Object,
 ) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	operator, ok := integerOperators[op]
+	if !ok {
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
 
-	var result int64
+	result, err := object.IntegerArithmetic(operator, left, right)
+	if err != nil {
+		return err
+	}
+	return vm.pushNew(result)
+}
+
+// Integer operands are promoted to float
+func (vm *VM) executeBinaryFloatOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	var result float64
 	switch op {
 	case code.OpAdd:
 		result = leftValue + rightValue
@@ -321,11 +584,29 @@ func (vm *VM) executeBinaryIntegerOperation(
 		result = leftValue * rightValue
 	case code.OpDiv:
 		result = leftValue / rightValue
+	case code.OpMod:
+		result = math.Mod(leftValue, rightValue)
+	case code.OpPow:
+		result = math.Pow(leftValue, rightValue)
 	default:
-		return fmt.Errorf("unknown integer operator: %d", op)
+		return fmt.Errorf("unknown float operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.pushNew(&object.Float{Value: result})
+}
+
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.IntegerToFloat(obj)
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
 }
 
 func (vm *VM) executeBinaryStringOperation(
@@ -339,12 +620,34 @@ func (vm *VM) executeBinaryStringOperation(
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
-	return vm.push(&object.String{Value: leftValue + rightValue})
+	return vm.pushNew(&object.String{Value: leftValue + rightValue})
 }
 
 func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	result := object.CompareIntegers(left, right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(result == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(result != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(result > 0))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(result >= 0))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+	// an integer and a float are compared without rounding
+	if left.Type() != right.Type() && !math.IsNaN(leftValue) && !math.IsNaN(rightValue) {
+		result, _ := object.Compare(left, right)
+		leftValue, rightValue = float64(result), 0
+	}
 
 	switch op {
 	case code.OpEqual:
@@ -353,6 +656,8 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
 	default:
 		return fmt.Errorf("unknown operator: %d", op)
 	}
@@ -384,16 +689,40 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashable(index)
 	if !ok {
-		return fmt.Errorf("unhsable as hash key: %s", index.Type())
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(key)
 	if !ok {
 		return vm.push(Null)
 	}
-	return vm.push(pair.Value)
+	return vm.push(value)
+}
+
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return fmt.Errorf("array index must be INTEGER, got %s", index.Type())
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return fmt.Errorf("index out of range: %d", i.Value)
+		}
+		left.Elements[i.Value] = value
+	case *object.Hash:
+		key, ok := object.AsHashable(index)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, value)
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -421,23 +750,32 @@ func (vm *VM) executeBangOperator() error {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation: %s", operand.Type())
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		return vm.pushNew(object.NegateInteger(operand))
+	case *object.Float:
+		return vm.pushNew(&object.Float{Value: -operand.Value})
 	}
-
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return fmt.Errorf("unsupported type for negation: %s", operand.Type())
 }
 
 func (vm *VM) push(o object.Object) error {
-	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+	if err := vm.ensureStack(vm.sp + 1); err != nil {
+		return err
 	}
 	vm.stack[vm.sp] = o
 	vm.sp++
 	return nil
 }
 
+// Push an object created by the VM, it counts against the object limit
+func (vm *VM) pushNew(o object.Object) error {
+	if err := vm.budget.Allocate(o); err != nil {
+		return err
+	}
+	return vm.push(o)
+}
+
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
@@ -460,22 +798,67 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
-		pair := object.HashPair{Key: key, Value: value}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashable(key)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
+	}
+
+	return hash, nil
+}
+
+// Call a closure or builtin from Go, with the globals and constants of the VM.
+// Errors are returned like RunContext does
+func (vm *VM) CallContext(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	vm.budget = object.NewBudget(ctx, object.Limits{
+		Instructions: vm.limits.Instructions,
+		Objects: vm.limits.Objects,
+	})
+
+	framesIndex, sp := vm.framesIndex, vm.sp
+	result, err := vm.call(fn, args)
+	if err == nil {
+		err = vm.budget.Err()
+	}
+	if err != nil {
+		rerr := vm.newRuntimeError(err)
+		vm.framesIndex, vm.sp = framesIndex, sp
+		return nil, rerr
+	}
+	return result, nil
+}
+
+// Run fn(args...) in a frame of its own on top of the current ones, so
+// that a call can also start while the VM is running
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	caller := &object.Closure{Fn: &object.CompiledFunction{
+		Instructions: code.Make(code.OpCall, len(args)),
+		Name: "<call>",
+	}}
+	err := vm.pushFrame(NewFrame(caller, vm.sp))
+	if err != nil { return nil, err }
+
+	err = vm.push(fn)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+	if err == nil {
+		// stops when the caller frame is done, the frames below are untouched
+		err = vm.run()
 	}
+	if err != nil { return nil, err }
 
-	return &object.Hash{Pairs: hashedPairs}, nil
+	result := vm.pop()
+	vm.popFrame()
+	return result, nil
 }
 
 func (vm *VM) executeCall(numArgs int) error {
@@ -491,30 +874,80 @@ func (vm *VM) executeCall(numArgs int) error {
 }
 
 
+// The callee replaces the current frame, so deep tail recursion runs in
+// constant stack space. Callers of the replaced frame are not in stack traces
+func (vm *VM) executeTailCall(numArgs int) error {
+	cl, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || numArgs != cl.Fn.NumParameters || vm.framesIndex == 1 {
+		// builtins and wrong calls behave as usual
+		return vm.executeCall(numArgs)
+	}
+
+	frame := vm.popFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	return vm.callClosure(cl, numArgs)
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
 	frame := NewFrame(cl, vm.sp - numArgs)
-	vm.pushFrame(frame)
+	if err := vm.ensureStack(frame.basePointer + cl.Fn.NumLocals); err != nil {
+		return err
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
+	// stale cells of a previous call must not be shared by the new locals
+	for i := frame.basePointer + numArgs; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+
 	return nil
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	if builtin.Cost != nil {
+		if err := vm.budget.Check(builtin.Cost(args...)); err != nil { return err }
+	}
+	caller := &builtinCaller{vm: vm}
+	result := builtin.Call(caller, args...)
+	if caller.err != nil {
+		// the frames of the failed call are kept for the stack trace
+		return caller.err
+	}
+	if err, ok := result.(*object.Error); ok {
+		// stops the program like in the evaluator
+		return fmt.Errorf("%s", err.Message)
+	}
 	vm.sp = vm.sp - numArgs - 1
 
-	if result != nil {
-		vm.push(result)
-	} else {
-		vm.push(Null)
+	if result == nil {
+		return vm.push(Null)
 	}
+	return vm.pushNew(result)
+}
 
-	return nil
+// Runs the closures passed to a builtin on top of the current frames
+type builtinCaller struct {
+	vm	*VM
+	err	error
+}
+
+func (c *builtinCaller) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	result, err := c.vm.call(fn, args)
+	c.err = err
+	return result, err
 }
 
 func (vm *VM) pushClosure(constIndex int, numFree int) error {
@@ -532,5 +965,5 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	vm.sp = vm.sp - numFree
 
 	closure := &object.Closure{Fn: function, Free: free}
-	return vm.push(closure)
+	return vm.pushNew(closure)
 }
\ No newline at end of file
@@ -1,13 +1,20 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"muc/ast"
 	"muc/compiler"
+	"muc/evaluator"
 	"muc/lexer"
 	"muc/object"
 	"muc/parser"
+	"muc/token"
+	"strings"
 	"testing"
+	"time"
 )
 
 func parse(input string) *ast.Program {
@@ -42,6 +49,19 @@ func testBooleanObject(expected bool, actual object.Object) error {
 	return nil
 }
 
+func testFloatObject(expected float64, actual object.Object) error {
+	result, ok := actual.(*object.Float)
+	if !ok {
+		return fmt.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+	}
+
+	return nil
+}
+
 func testStringObject(expected string, actual object.Object) error {
 	result, ok := actual.(*object.String)
 	if !ok {
@@ -71,9 +91,19 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		if err != nil {
 			t.Fatalf("compile error: %s", err)
 		}
+		if err := comp.Bytecode().Validate(); err != nil {
+			t.Fatalf("invalid bytecode for %q: %s", tt.input, err)
+		}
 
 		vm := New(comp.Bytecode())
 		err = vm.Run()
+		// an error of a builtin stops the program
+		if expected, ok := tt.expected.(*object.Error); ok {
+			if err == nil || err.Error() != expected.Message {
+				t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, expected.Message, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm run error: %s", err)
 		}
@@ -97,6 +127,11 @@ func testExpectedObject(
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case float64:
+		err := testFloatObject(expected, actual)
+		if err != nil {
+			t.Errorf("testFloatObject failed: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(bool(expected), actual)
 		if err != nil {
@@ -137,13 +172,17 @@ func testExpectedObject(
 			return
 		}
 
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), len(hash.Pairs))
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. want=%d, got=%d", len(expected), hash.Len())
 			return
 		}
-		
+
+		pairs := map[object.HashKey]object.HashPair{}
+		for _, pair := range hash.Pairs() {
+			pairs[pair.Key.(object.Hashable).HashKey()] = pair
+		}
 		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+			pair, ok := pairs[expectedKey]
 
 			if !ok {
 				t.Errorf("no pair for given key in Pairs")
@@ -155,6 +194,16 @@ func testExpectedObject(
 			}
 		}
 
+	case *big.Int:
+		result, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt. got=%T (%+v)", actual, actual)
+			return
+		}
+		if result.Value.Cmp(expected) != 0 {
+			t.Errorf("object has wrong value. want=%s, got=%s", expected, result.Value)
+		}
+
 	case *object.Error:
 		errObj, ok := actual.(*object.Error)
 		if !ok {
@@ -181,6 +230,34 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"5 ** 0", 1},
+		{"2 ** -1", 0.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 > 1", true},
+		{"1 < 1.5", true},
+		{"2.0 == 2", true},
+		{"2.5 != 2.5", false},
+		{`{2.5: 1}[2.5]`, 1},
+		{"7.5 % 2", 1.5},
+		{"4 ** 0.5", 2.0},
+		{"1 / 0.0 > 1000000", true},
 	}
 
 	runVmTests(t, tests)
@@ -192,6 +269,19 @@ func TestBooleanExpressions(t *testing.T) {
 		{"false", false},
 		{"1 < 2", true},
 		{"1 > 2", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 2", true},
+		{"2 >= 2.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"a\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3 || false", true},
 		{"1 < 1", false},
 		{"1 == 1", true},
 		{"1 != 1", false},
@@ -206,12 +296,102 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!null", true},
+		{"!!null", false},
 		{"!(if (false) {5;})", true},
 	}
 
 	runVmTests(t, tests)
 }
 
+func TestStructuralEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"apple" < "banana"`, true},
+		{`"b" >= "abc"`, true},
+		{`"Z" > "a"`, false},
+		{`"" <= ""`, true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2.0] == [1.0, 2]", true},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`[{"a": [1]}] == [{"a": [1]}]`, true},
+		{`[1, "a", true] == [1, "a", true]`, true},
+		{"[1] == 1", false},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b", true},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{`contains([[1, 2]], [1, 2])`, true},
+		{`index_of(["a", "b"], "b")`, 1},
+		{`sort(["pear", "apple", "fig"]) == ["apple", "fig", "pear"]`, true},
+	}
+
+	runVmTests(t, tests)
+
+	for _, input := range []string{"[1] < [2]", `"a" > 1`} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err == nil || !strings.HasPrefix(err.Error(), "cannot compare") {
+			t.Errorf("expected comparison error for %q, got=%v", input, err)
+		}
+	}
+}
+
+func TestNullOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"null == null", true},
+		{"[1, 2][5] == null", true},
+		{"!null", true},
+		{"null ?? 1", 1},
+		{"2 ?? 1", 2},
+		{"false ?? 1", false},
+		{"null ?? null ?? 3", 3},
+		{"let n = 0; let f = fn() { n = n + 1 }; 1 ?? f(); n", 0},
+		{`let h = null; h?["a"]`, Null},
+		{`let h = {"a": {"b": 1}}; h?["a"]?["b"]`, 1},
+		{`let h = {"a": null}; h?["a"]?["b"] ?? 7`, 7},
+		{"let a = null; a?[0][1]", Null},
+		{"let a = null; a?[0][1][2] ?? 3", 3},
+		{"let a = [[1, [2]]]; a?[0][1][0]", 2},
+		{"let n = 0; let f = fn() { n = n + 1 }; null?[f()]; n", 0},
+		{"let get = fn(a) { a?[0] ?? -1 }; [get([5]), get([]), get(null)]", []int{5, -1, -1}},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Reading a variable in its own definition is an error, not a Go nil
+func TestUnsetVariables(t *testing.T) {
+	inputs := []string{
+		"if (false) { let g = 1; } g ?? 1;",
+		"if (false) { let g = [1]; } g?[0];",
+		"let f = fn() { if (false) { let x = 1; } x ?? 1 }; f()",
+		"let f = fn() { if (false) { let x = [1]; } x?[0] }; f()",
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil || err.Error() != "variable used before it is set" {
+			t.Errorf("wrong error for %q. got=%v", input, err)
+		}
+	}
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -294,6 +474,20 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 3}[2]", 3},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`{[1, "a"]: 1, [1, "b"]: 2}[[1, "b"]]`, 2},
+		{"{[[1], [2]]: 3}[[[1], [2]]]", 3},
+		{"{[1, 2]: 1}[[2, 1]]", Null},
+		{"let k = [1]; let h = {}; h[k] = 1; k[0] = 2; h[[1]]", 1},
+		{"let h = {[1]: 1}; h[[1]] = 2; len(keys(h))", 1},
+		{`has_key({[true, "x"]: 1}, [true, "x"])`, true},
+		{"{1: 1}[1.0]", 1},
+		{"{0.0: 1}[-0.0]", 1},
+		{"{-0.0: 1}[0]", 1},
+		{"{1.5: 1}[1.5]", 1},
+		{"{[1, 2]: 1}[[1.0, 2.0]]", 1},
+		{"{18446744073709551616: 1}[18446744073709551616.0]", 1},
+		{"{9007199254740993: 1}[9007199254740992.0]", Null},
+		{"let h = {1: 1}; h[1.0] = 2; len(keys(h))", 1},
 	}
 
 	runVmTests(t, tests)
@@ -554,6 +748,185 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`map([], fn(x) { x })`, []int{}},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, []int{11, 12}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, 10},
+		{`reduce([1, 2, 3], fn(acc, x) { acc * x }, 10)`, 60},
+		{`reduce([], fn(acc, x) { acc + x }, 0)`, 0},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`let a = [2, 1]; sort(a); a`, []int{2, 1}},
+		{`sort(["b", "c", "a"])[0]`, "a"},
+		{`map([[1], [2, 3]], len)`, []int{1, 2}},
+		{`let sum = fn(xs) { reduce(xs, fn(a, b) { a + b }, 0) }; map([[1, 2], [3]], sum)`, []int{3, 3}},
+		{`reduce([], fn(acc, x) { acc + x })`, &object.Error{Message: "`reduce` of an empty array without initial value"}},
+		{`sort([1, "a"])`, &object.Error{Message: "cannot compare STRING with INTEGER"}},
+		{`map(1, fn(x) { x })`, &object.Error{Message: "argument 1 to `map` must be ARRAY, got INTEGER"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`first([1, 2])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2])`, 2},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`let a = [1]; let b = push(a, 2); len(a) + len(b)`, 3},
+		{`slice([1, 2, 3, 4], 1, 3)`, []int{2, 3}},
+		{`slice([1, 2, 3, 4], -2)`, []int{3, 4}},
+		{`slice([1, 2, 3], 2, 1)`, []int{}},
+		{`slice([1, 2, 3], 0, 10)`, []int{1, 2, 3}},
+		{`concat([1], [], [2, 3])`, []int{1, 2, 3}},
+		{`concat()`, []int{}},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`contains([1, "a", true], "a")`, true},
+		{`contains([1, 2], 3)`, false},
+		{`contains([1, 2], 2) == true`, true},
+		{`index_of([1, 2, 3], 3)`, 2},
+		{`index_of([1, 2, 3], 4)`, -1},
+		{`join(["a", 1, true], ", ")`, "a, 1, true"},
+		{`join([1, 2])`, "12"},
+		{`range(4)`, []int{0, 1, 2, 3}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`range(3, 1)`, []int{}},
+		{`range(9223372036854775800, 9223372036854775807, 10)`, []int{9223372036854775800}},
+		{`range(-9223372036854775807 - 1, -9223372036854775800, 4)`, []int{-9223372036854775808, -9223372036854775804}},
+		{`range(9223372036854775807, 9223372036854775800, -9223372036854775807 - 1)`, []int{9223372036854775807}},
+		{`range(-9223372036854775807 - 1, 9223372036854775807)`, &object.Error{Message: "`range` of 18446744073709551615 elements is too long"}},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`zip([1, 2], [3, 4])[1]`, []int{2, 4}},
+		{`flatten([1, [2, 3], [], [4, [5]]])[4]`, []int{5}},
+		{`len(flatten([1, [2, 3], [], [4, [5]]]))`, 5},
+		{`unique([1, 2, 1, 3, 2])`, []int{1, 2, 3}},
+		{`first(1)`, &object.Error{Message: "argument 1 to `first` must be ARRAY, got INTEGER"}},
+		{`slice([1], "a")`, &object.Error{Message: "argument 2 to `slice` must be INTEGER, got STRING"}},
+		{`concat([1], 2)`, &object.Error{Message: "argument 2 to `concat` must be ARRAY, got INTEGER"}},
+		{`push([1])`, &object.Error{Message: "wrong number of arguments. got=1, want=2"}},
+		{`range(1, 2, 0)`, &object.Error{Message: "step of `range` must not be 0"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`join(keys({"b": 1, "a": 2, 3: 3}), ",")`, "b,a,3"},
+		{`values({"b": 1, "a": 2})`, []int{1, 2}},
+		{`items({"b": 1, "a": 2})[1][1]`, 2},
+		{`let h = {}; h["z"] = 1; h["y"] = 2; h["z"] = 3; join(keys(h), ",")`, "z,y"},
+		{`has_key({"a": 1}, "a")`, true},
+		{`has_key({"a": 1}, "b")`, false},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); len(keys(h)) * 10 + len(keys(d))`, 21},
+		{`join(keys(delete({1: 1, 2: 2, 3: 3}, 2)), ",")`, "1,3"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})["b"]`, 3},
+		{`join(keys(merge({"a": 1, "b": 2}, {"c": 4, "a": 3})), ",")`, "a,b,c"},
+		{`let s = ""; for (k in {"x": 1, "y": 2, "w": 3}) { s = s + k }; s`, "xyw"},
+		{`keys([1])`, &object.Error{Message: "argument 1 to `keys` must be HASH, got ARRAY"}},
+		{`has_key({}, [len])`, &object.Error{Message: "argument 2 to `has_key` is unusable as hash key: ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`split("a,b,,c", ",")[3]`, "c"},
+		{`len(split("a,b,,c", ","))`, 4},
+		{`len(split("  a b\tc  "))`, 3},
+		{`join(split("a-b", "-"), "+")`, "a+b"},
+		{`trim("  mua \n")`, "mua"},
+		{`upper("Mua")`, "MUA"},
+		{`lower("Mua")`, "mua"},
+		{`replace("a.b.c", ".", "::")`, "a::b::c"},
+		{`contains("mua-lang", "a-l")`, true},
+		{`contains("mua", "x")`, false},
+		{`contains([1, 2], 2)`, true},
+		{`starts_with("mua-lang", "mua")`, true},
+		{`ends_with("mua-lang", "mua")`, false},
+		{`find("héllo", "llo")`, 2},
+		{`find("hello", "x")`, -1},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`len(chars("héllo"))`, 5},
+		{`chars("héllo")[1]`, "é"},
+		{`substr("héllo", 1, 3)`, "él"},
+		{`let s = "héllo"; substr(s, 0, len(s) - 1)`, "héll"},
+		{`let s = "héllo"; [len(s), len(chars(s)), find(s, "o")]`, []int{5, 5, 4}},
+		{`substr("hello", -3)`, "llo"},
+		{`format("%s is %d, %v and 100%%", "mua", 3, [1, true])`, "mua is 3, [1, true] and 100%"},
+		{`to_string(12) + to_string("a") + to_string(1.5)`, "12a1.5"},
+		{`parse_int(" 42 ")`, 42},
+		{`parse_int("-ff", 16)`, -255},
+		{`upper(1)`, &object.Error{Message: "argument 1 to `upper` must be STRING, got INTEGER"}},
+		{`repeat("a", -1)`, &object.Error{Message: "count of `repeat` must not be negative, got -1"}},
+		{`repeat("ab", 9223372036854775807)`, &object.Error{Message: "result of `repeat` is too long"}},
+		{`repeat("", 9223372036854775807)`, ""},
+		{`format("%d", "a")`, &object.Error{Message: "%d in `format` needs INTEGER, got STRING"}},
+		{`format("%s %s", "a")`, &object.Error{Message: "missing argument for %s in `format`"}},
+		{`format("%s", "a", "b")`, &object.Error{Message: "too many arguments for `format`. got=2, want=1"}},
+		{`format("%x", 1)`, &object.Error{Message: "unknown verb %x in `format`"}},
+		{`parse_int("12a")`, &object.Error{Message: "cannot parse \"12a\" as integer"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashInspectOrder(t *testing.T) {
+	input := `let h = {"one": 1, 2: "two", true: [3]}; h["four"] = 4; h`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	inspected := vm.LastPoppedStackElem().Inspect()
+	if inspected != "{one: 1, 2: two, true: [3], four: 4}" {
+		t.Errorf("wrong Inspect. got=%q", inspected)
+	}
+}
+
+func TestHigherOrderBuiltinErrors(t *testing.T) {
+	input := `let f = fn(x) { x + true };
+map([1], f);`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError, got=%T (%+v)", err, err)
+	}
+	if rerr.Message != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong message. got=%q", rerr.Message)
+	}
+
+	functions := []string{}
+	for _, entry := range rerr.Trace {
+		functions = append(functions, entry.Function)
+	}
+	if strings.Join(functions, " ") != "f <call> <main>" {
+		t.Errorf("wrong trace. got=%q", rerr.StackTrace())
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -592,4 +965,625 @@ func TestRecursiveFibonacci(t *testing.T) {
 	}
 
 	runVmTests(t, tests)
-}
\ No newline at end of file
+}
+
+func TestRecursiveClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let wrapper = fn() {
+				let fibonacci = fn(x) {
+					if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) }
+				};
+				fibonacci(15);
+			};
+			wrapper();
+			`,
+			expected: 610,
+		},
+		{
+			input: `
+			let wrapper = fn(n) {
+				let countDown = fn(x) {
+					let step = fn() { countDown(x - 1) };
+					if (x == 0) { "done" } else { step() }
+				};
+				countDown(n);
+			};
+			wrapper(10);
+			`,
+			expected: "done",
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let f = fn(x) { if (x > 0) { f(x - 1) } else { 0 } };
+				let g = f;
+				f = fn(x) { 100 };
+				g(1);
+			};
+			wrapper();
+			`,
+			expected: 100,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// A `let` in the same scope rebinds the variable closures already see, in
+// both engines
+func TestLetShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; let f = fn() { a }; let a = 2; [f(), a]", "[2, 2]"},
+		{"let a = 1; let f = fn() { a }; let a = 2; a = 3; f()", "3"},
+		{"let g = fn() { let x = 1; let f = fn() { x }; let x = 2; [f(), x] }; g()", "[2, 2]"},
+		{"let x = 10; let f = fn() { let x = x + 1; x }; [f(), x]", "[11, 10]"},
+		{`let len = len("abc"); len`, "3"},
+		{"let f = fn(n) { n }; let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3)", "0"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("vm: wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+
+		evaluated := evaluator.Eval(parse(tt.input), object.NewEnvironment())
+		if got := evaluated.Inspect(); got != tt.expected {
+			t.Errorf("evaluator: wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } };
+			sum(100000, 0);
+			`,
+			expected: 5000050000,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let count = fn(n) { if (n == 0) { return "done"; } return count(n - 1); };
+				count(100000);
+			};
+			wrapper();
+			`,
+			expected: "done",
+		},
+		{
+			// a tail call to a builtin, and calls whose result is used
+			input: `
+			let f = fn(x) { len(x) };
+			let twice = fn(x) { f([x, x]) + 0 };
+			let count = fn(x) { twice(x) };
+			count("x") + f("abc");
+			`,
+			expected: 5,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestWhileLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let i = 0; let s = 0; while (i < 5) { let s = s + i; let i = i + 1; }; s`, 10},
+		{`let i = 0; while (true) { let i = i + 1; if (i > 3) { break; } }; i`, 4},
+		{`let i = 0; let s = 0; while (i < 5) { let i = i + 1; if (i == 2) { continue; } let s = s + i; }; s`, 13},
+		{`let f = fn() { let i = 0; while (true) { let i = i + 1; if (i == 7) { return i; } } }; f()`, 7},
+		{`let f = fn() { let i = 0; while (i < 100000) { let i = i + 1; } i }; f()`, 100000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let s = 0; for (x in [1, 2, 3]) { let s = s + x; }; s`, 6},
+		{`let s = ""; for (c in "abc") { let s = c + s; }; s`, "cba"},
+		{`let s = 0; for (k in {1: "a", 2: "b"}) { let s = s + k; }; s`, 3},
+		{`let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } let s = s + x; }; s`, 4},
+		{`let f = fn(arr) { let s = 0; for (x in arr) { for (y in arr) { let s = s + x * y; } } s }; f([1, 2])`, 9},
+		{`let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } }; f([1, 5, 9])`, 5},
+		{`let fns = []; let f = fn() { for (x in [1]) { } }; f()`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIterateNonIterable(t *testing.T) {
+	program := parse(`for (x in 5) { x }`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+	if err.Error() != "cannot iterate over INTEGER" {
+		t.Fatalf("wrong VM error: got=%q", err)
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let x = 1; x = x + 1; x`, 2},
+		{`let x = 1; x = 5`, 5},
+		{`let a = 0; let b = 0; a = b = 3; a + b`, 6},
+		{`let i = 0; let s = 0; while (i < 5) { s = s + i; i = i + 1; }; s`, 10},
+		{`let f = fn(x) { x = x * 2; x }; f(4)`, 8},
+		{`let f = fn() { let x = 1; x = 2; x }; f()`, 2},
+		{`let arr = [1, 2, 3]; arr[1] = 5; arr`, []int{1, 5, 3}},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let arr = [[1], [2]]; arr[1][0] = 9; arr[1][0]`, 9},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignCapturedVariables(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newCounter = fn() {
+				let count = 0;
+				fn() { count = count + 1; count }
+			};
+			let counter = newCounter();
+			counter(); counter();
+			counter();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let f = fn() {
+				let x = 1;
+				let set = fn(v) { x = v; };
+				let get = fn() { x };
+				set(10);
+				x + get()
+			};
+			f();
+			`,
+			expected: 20,
+		},
+		{
+			input: `
+			let f = fn() {
+				let x = 1;
+				let g = fn() { fn() { x = x + 1; } };
+				g()(); g()();
+				x
+			};
+			f();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let newCounter = fn() {
+				let count = 0;
+				fn() { count = count + 1; count }
+			};
+			let a = newCounter();
+			let b = newCounter();
+			a(); a(); b();
+			a() * 10 + b()
+			`,
+			expected: 32,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDivisionByZero(t *testing.T) {
+	inputs := []string{"1 / 0", "1 % 0", "let f = fn(a, b) { a / b }; f(1, 0)", "18446744073709551616 % 0"}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil || err.Error() != "division by zero" {
+			t.Errorf("expected division by zero for %q, got=%v", input, err)
+		}
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []vmTestCase{
+		{"9223372036854775807 + 1", bigInt("9223372036854775808")},
+		{"-9223372036854775807 - 2", bigInt("-9223372036854775809")},
+		{"4611686018427387904 * 4", bigInt("18446744073709551616")},
+		{"2 ** 64", bigInt("18446744073709551616")},
+		{"-9223372036854775808 / -1", bigInt("9223372036854775808")},
+		{"99999999999999999999", bigInt("99999999999999999999")},
+		{"-99999999999999999999 * 3", bigInt("-299999999999999999997")},
+		{"18446744073709551616 / 2", bigInt("9223372036854775808")},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"18446744073709551616 % 7", 2},
+		{"-9223372036854775808", -9223372036854775808},
+		{"99999999999999999999 > 9223372036854775807", true},
+		{"-99999999999999999999 >= 0", false},
+		{"10 ** 20 == 100000000000000000000", true},
+		{"2 ** 64 != 2 ** 64", false},
+		{"9007199254740993 == 9007199254740992.0", false},
+		{"9007199254740993 > 9007199254740992.0", true},
+		{"18446744073709551616 + 0.5", 18446744073709551616.5},
+		{"let h = {18446744073709551616: 1}; h[2 ** 64]", 1},
+		{"abs(-99999999999999999999)", bigInt("99999999999999999999")},
+		{"max(2 ** 64, 1)", bigInt("18446744073709551616")},
+		{"pow(10, 19)", bigInt("10000000000000000000")},
+		{"floor(1e19)", bigInt("10000000000000000000")},
+		{`parse_int("ffffffffffffffff", 16)`, bigInt("18446744073709551615")},
+		{`format("%d", 2 ** 64)`, "18446744073709551616"},
+		{"contains([2 ** 64], 18446744073709551616)", true},
+		{"pow(2, 100000000)", &object.Error{Message: "integer too large"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func bigInt(s string) *big.Int {
+	value, _ := new(big.Int).SetString(s, 10)
+	return value
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{"abs(-3)", 3},
+		{"abs(-2.5)", 2.5},
+		{"min(3, 1, 2)", 1},
+		{"max([3, 1.5, 2])", 3},
+		{"max(1, 2.5)", 2.5},
+		{"pow(3, 4)", 81},
+		{"pow(4, 0.5)", 2.0},
+		{"pow(2, -2)", 0.25},
+		{"sqrt(16)", 4.0},
+		{"floor(2.7)", 2},
+		{"floor(-2.5)", -3},
+		{"ceil(2.1)", 3},
+		{"ceil(5)", 5},
+		{"clamp(15, 0, 10)", 10},
+		{"clamp(-1.5, 0, 10)", 0},
+		{"clamp(5, 0, 10)", 5},
+		{"gcd(12, -18)", 6},
+		{"gcd(0, 5)", 5},
+		{"gcd(-9223372036854775807 - 1, 0)", bigInt("9223372036854775808")},
+		{"gcd(-9223372036854775807 - 1, 6)", 2},
+		{"min()", &object.Error{Message: "`min` of no values"}},
+		{`max(1, "a")`, &object.Error{Message: "cannot compare INTEGER with STRING"}},
+		{"sqrt(-1)", &object.Error{Message: "`sqrt` of negative number -1"}},
+		{`abs("a")`, &object.Error{Message: "argument 1 to `abs` must be a number, got STRING"}},
+		{"clamp(1, 10, 0)", &object.Error{Message: "`clamp` with low 10 greater than high 0"}},
+		{"gcd(1.5, 2)", &object.Error{Message: "argument 1 to `gcd` must be INTEGER, got FLOAT"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUnhashableArrayKeys(t *testing.T) {
+	inputs := []string{"{[fn() {}]: 1}", "{}[[1, {}]]", "let a = [1]; a[0] = a; {a: 1}"}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err == nil || err.Error() != "unusable as hash key: ARRAY" {
+			t.Errorf("wrong error for %q. got=%v", input, err)
+		}
+	}
+}
+
+func TestIndexAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = [1]; a[1] = 2`, "index out of range: 1"},
+		{`let a = [1]; a["x"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn() {}] = 2`, "unusable as hash key: CLOSURE"},
+		{`let s = "a"; s[0] = "b"`, "index assignment not supported: STRING"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	tests := []vmTestCase{
+		{`let n = 0; let f = fn() { n = n + 1; true }; false && f(); true || f(); n`, 0},
+		{`let n = 0; let f = fn() { n = n + 1; true }; true && f(); false || f(); n`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let add = fn(a, b) { a + b };
+let apply = fn(f) { let r = f(1, true); r };
+apply(add);
+apply(fn(a) { a });`
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError, got=%T (%+v)", err, err)
+	}
+
+	expected := []TraceEntry{
+		{"add", 4, token.Position{Line: 1, Column: 24}},
+		{"apply", 6, token.Position{Line: 2, Column: 30}},
+		{"<main>", 20, token.Position{Line: 3, Column: 6}},
+	}
+	if rerr.Message != "unsupported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong message. got=%q", rerr.Message)
+	}
+	if len(rerr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d\n%s", len(expected), len(rerr.Trace), rerr.StackTrace())
+	}
+	for i, entry := range expected {
+		if rerr.Trace[i] != entry {
+			t.Errorf("wrong trace entry %d. want=%+v, got=%+v", i, entry, rerr.Trace[i])
+		}
+	}
+	if !strings.HasPrefix(rerr.StackTrace(), "\tat add (1:24, offset 0004)\n\tat apply (2:30, offset 0006)\n") {
+		t.Errorf("wrong stack trace. got=%q", rerr.StackTrace())
+	}
+}
+
+func TestDeepStackTrace(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse("let f = fn(n) { 1 + f(n + 1) };\nf(0);"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetLimits(Limits{StackSize: StackSize, MaxFrames: 1000})
+	err = vm.Run()
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected *RuntimeError, got=%T (%+v)", err, err)
+	}
+
+	if len(rerr.Trace) != 2 * traceEnds || rerr.Trace[0].Function != "f" || rerr.Trace[len(rerr.Trace) - 1].Function != "<main>" {
+		t.Fatalf("wrong trace. got=%+v", rerr.Trace)
+	}
+	if rerr.Omitted + len(rerr.Trace) != 1000 {
+		t.Errorf("wrong number of omitted calls. got=%d", rerr.Omitted)
+	}
+	expected := fmt.Sprintf(`	at f (1:22, offset 0012)
+	... repeated 9 more times ...
+	... %d more frames ...
+	at f (1:22, offset 0012)
+	... repeated 8 more times ...
+	at <main> (2:2, offset 0013)
+`, rerr.Omitted)
+	if rerr.StackTrace() != expected {
+		t.Errorf("wrong stack trace. want=%q, got=%q", expected, rerr.StackTrace())
+	}
+}
+
+func TestGrowingStacks(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			// deeper than the initial stacks, and not a tail call
+			input: `
+			let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } };
+			depth(10000);
+			`,
+			expected: 10000,
+		},
+		{
+			input: `
+			let build = fn(n) { if (n == 0) { [] } else { let a = build(n - 1); [a, a] } };
+			len(build(2000));
+			`,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits Limits
+	}{
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0);", DefaultLimits},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0);", Limits{StackSize: StackSize, MaxFrames: 10}},
+		{"let f = fn(a, b, c) { a + b + c }; f(1, 2, 3);", Limits{StackSize: 3, MaxFrames: MaxFrames}},
+		{"[1, 2, 3, 4, 5]", Limits{StackSize: 4, MaxFrames: MaxFrames}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err = vm.Run()
+		if err == nil || !strings.HasPrefix(err.Error(), "stack overflow") {
+			t.Errorf("expected stack overflow for %q, got=%v", tt.input, err)
+		}
+	}
+}
+
+func TestGlobalsAllocatedLazily(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse("let a = 1; let b = a + 1;"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if len(vm.Globals()) != 0 {
+		t.Fatalf("globals allocated before running. got=%d", len(vm.Globals()))
+	}
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if len(vm.Globals()) != 2 {
+		t.Fatalf("wrong number of globals. want=2, got=%d", len(vm.Globals()))
+	}
+
+	// the next VM continues with the same globals, like the REPL
+	comp = compiler.NewWithState(symbolTable, comp.Bytecode().Constants)
+	err = comp.Compile(parse("a + b"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm = NewWithGlobalsState(comp.Bytecode(), vm.Globals())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(3, vm.LastPoppedStackElem()); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+func TestRunContextLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancelExpired()
+
+	loop := "let x = 0; while (true) { x = x + 1; }"
+	recursion := "let f = fn(n) { 1 + f(n + 1) }; f(0);"
+
+	tests := []struct {
+		ctx    context.Context
+		input  string
+		limits Limits
+		check  func(err error) bool
+	}{
+		{cancelled, loop, DefaultLimits, func(err error) bool {
+			var target *object.CancelledError
+			return errors.As(err, &target) && errors.Is(err, context.Canceled)
+		}},
+		{expired, loop, DefaultLimits, func(err error) bool {
+			return errors.Is(err, context.DeadlineExceeded)
+		}},
+		{context.Background(), loop, Limits{StackSize: StackSize, MaxFrames: MaxFrames, Instructions: 1000}, func(err error) bool {
+			var target *object.InstructionLimitError
+			return errors.As(err, &target) && target.Limit == 1000
+		}},
+		{context.Background(), recursion, Limits{StackSize: StackSize, MaxFrames: 50}, func(err error) bool {
+			var target *object.CallDepthError
+			return errors.As(err, &target) && target.Limit == 50
+		}},
+		{context.Background(), loop, Limits{StackSize: StackSize, MaxFrames: MaxFrames, Objects: 500}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target) && target.Limit == 500
+		}},
+		{context.Background(), "let a = [1, 2, 3]; [a, a, a]", Limits{StackSize: StackSize, MaxFrames: MaxFrames, Objects: 7}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+		{context.Background(), `let s = "x"; while (true) { s = s + s }`, Limits{StackSize: StackSize, MaxFrames: MaxFrames, Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+		{context.Background(), `range(10000000)`, Limits{StackSize: StackSize, MaxFrames: MaxFrames, Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+		{context.Background(), `repeat("x", 100000000)`, Limits{StackSize: StackSize, MaxFrames: MaxFrames, Objects: 100}, func(err error) bool {
+			var target *object.ObjectLimitError
+			return errors.As(err, &target)
+		}},
+	}
+
+	for i, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		err = vm.RunContext(tt.ctx)
+		if _, ok := err.(*RuntimeError); !ok {
+			t.Fatalf("tests[%d] - expected *RuntimeError, got=%T (%v)", i, err, err)
+		}
+		if !tt.check(err) {
+			t.Errorf("tests[%d] - wrong error. got=%v", i, err)
+		}
+	}
+
+	// within the limits
+	comp := compiler.New()
+	err := comp.Compile(parse("let a = [1, 2, 3]; len(a)"))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	vm.SetLimits(Limits{StackSize: 16, MaxFrames: 2, Instructions: 20, Objects: 8})
+	if err := vm.RunContext(context.Background()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}